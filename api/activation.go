@@ -0,0 +1,97 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/core/cache"
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/models"
+	"github.com/go-pandora/core/notify"
+	"github.com/go-pandora/core/util/randutil"
+	"net/http"
+)
+
+// ActivateUser consumes an activation token and activates its owner.
+func ActivateUser(c *gin.Context) {
+	var err error
+	defer func() { c.Set("error", err) }()
+
+	token := c.Query("token")
+	if token == "" {
+		err = errs.ErrInvalidToken
+		return
+	}
+
+	var user models.User
+	if user.Id, err = cache.ConsumeActivationToken(token); err != nil {
+		return
+	}
+	if err = user.ActivateUser(); err != nil {
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+type activationRequest struct {
+	Email string `json:"email"`
+}
+
+// ResendActivation sends a new activation link to an inactive user.
+// Links sent before will no longer work.
+// It always succeeds for a valid email address, so that nobody can tell whether the address has been registered.
+func ResendActivation(c *gin.Context) {
+	var (
+		req activationRequest
+		err error
+	)
+	defer func() { c.Set("error", err) }()
+
+	if err = BindJSON(c, &req); err != nil {
+		return
+	}
+	if req.Email == "" {
+		err = errs.ErrInvalidEmail
+		return
+	}
+	user := models.User{Email: &req.Email}
+	if err = user.GetUserByContact(); err == errs.ErrUserNotFound {
+		err = nil
+		c.Status(http.StatusOK)
+		return
+	} else if err != nil {
+		return
+	}
+
+	if user.Status == models.Inactive {
+		if err = sendActivationEmail(&user); err != nil {
+			return
+		}
+	}
+	c.Status(http.StatusOK)
+}
+
+// sendActivationEmail issues a single-use activation token and mails the link to user.
+func sendActivationEmail(user *models.User) error {
+	token, err := randutil.Token(32)
+	if err != nil {
+		return errs.New(err)
+	}
+	if err = cache.SetActivationToken(user.Id, token); err != nil {
+		return errs.New(err)
+	}
+
+	mail := &notify.Mail{
+		To:       *user.Email,
+		Subject:  "Activate your Pandora account",
+		Template: "activation.html",
+		Data: map[string]string{
+			"name": user.Username,
+			"link": Config.BaseURL + "/auth/activate?token=" + token,
+		},
+	}
+	if err = notify.SendMail(mail); err != nil {
+		return errs.New(err)
+	}
+	return nil
+}
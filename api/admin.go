@@ -0,0 +1,208 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var userStatuses = map[string]int{
+	"inactive":   models.Inactive,
+	"normal":     models.Normal,
+	"restricted": models.Restricted,
+	"banned":     models.Banned,
+}
+
+var userGenders = map[string]int{
+	"unknown": models.Unknown,
+	"male":    models.Male,
+	"female":  models.Female,
+}
+
+// adminUserView shows a user to administrators.
+type adminUserView struct {
+	Id        int64           `json:"id"`
+	Username  string          `json:"username"`
+	Email     *string         `json:"email"`
+	Cellphone *string         `json:"cellphone"`
+	Age       int             `json:"age"`
+	Gender    int             `json:"gender"`
+	Status    int             `json:"status"`
+	CreateAt  models.JsonTime `json:"create_at"`
+	LastLogin models.JsonTime `json:"last_login"`
+}
+
+// ListUsers lists users with filters.
+// Query parameters:
+//
+//	status, gender: name or number, e.g. status=banned or status=3
+//	created_from, created_to, last_login_from, last_login_to: "2006-01-02" or "2006-01-02 15:04:05"
+//	q: substring of username, email address or cellphone number
+//	sort: id, create_at, last_login or username, order: asc or desc
+//	page, page_size: offset pagination
+//	cursor: cursor pagination, use next_cursor of the previous page with the same sort and order,
+//	        and an empty cursor means the first page
+func ListUsers(c *gin.Context) {
+	var err error
+	defer func() { c.Set("error", err) }()
+
+	var f models.UserFilter
+	if err = parseUserFilter(c, &f); err != nil {
+		return
+	}
+
+	pageSize, page := defaultPageSize, 1
+	if v := c.Query("page_size"); v != "" {
+		if pageSize, err = strconv.Atoi(v); err != nil || pageSize <= 0 || pageSize > maxPageSize {
+			err = errs.ErrInvalidParam
+			return
+		}
+	}
+	pagination := &Pagination{PageSize: pageSize}
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		if cursor != "" {
+			f.Cursor = new(models.UserCursor)
+			if err = decodeCursor(cursor, f.Cursor); err != nil {
+				return
+			}
+		}
+	} else {
+		if v := c.Query("page"); v != "" {
+			if page, err = strconv.Atoi(v); err != nil || page <= 0 {
+				err = errs.ErrInvalidParam
+				return
+			}
+		}
+		f.Offset = (page - 1) * pageSize
+		pagination.Page = page
+	}
+	// Fetch one more user to know whether there is a next page.
+	f.Limit = pageSize + 1
+
+	users, total, err := models.FindUsers(&f)
+	if err != nil {
+		return
+	}
+	pagination.Total = total
+	if len(users) > pageSize {
+		users = users[:pageSize]
+		pagination.NextCursor = encodeCursor(f.CursorOf(&users[pageSize-1]))
+	}
+
+	views := make([]adminUserView, 0, len(users))
+	for _, u := range users {
+		views = append(views, adminUserView{
+			Id:        u.Id,
+			Username:  u.Username,
+			Email:     u.Email,
+			Cellphone: u.Cellphone,
+			Age:       u.Age,
+			Gender:    u.Gender,
+			Status:    u.Status,
+			CreateAt:  u.CreateAt,
+			LastLogin: u.LastLogin,
+		})
+	}
+	c.JSON(http.StatusOK, Response{Data: views, Pagination: pagination})
+}
+
+func parseUserFilter(c *gin.Context, f *models.UserFilter) (err error) {
+	if f.Status, err = parseEnum(c.Query("status"), userStatuses); err != nil {
+		return
+	}
+	if f.Gender, err = parseEnum(c.Query("gender"), userGenders); err != nil {
+		return
+	}
+	if f.CreatedFrom, err = parseTime(c.Query("created_from"), false); err != nil {
+		return
+	}
+	if f.CreatedTo, err = parseTime(c.Query("created_to"), true); err != nil {
+		return
+	}
+	if f.LastLoginFrom, err = parseTime(c.Query("last_login_from"), false); err != nil {
+		return
+	}
+	if f.LastLoginTo, err = parseTime(c.Query("last_login_to"), true); err != nil {
+		return
+	}
+	f.Search = strings.TrimSpace(c.Query("q"))
+
+	f.Sort = c.DefaultQuery("sort", "id")
+	if !models.IsValidSort(f.Sort) {
+		return errs.ErrInvalidParam
+	}
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		f.Desc = true
+	default:
+		return errs.ErrInvalidParam
+	}
+	return
+}
+
+// parseEnum accepts either a name in values or a number.
+func parseEnum(s string, values map[string]int) (*int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if v, ok := values[strings.ToLower(s)]; ok {
+		return &v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, errs.ErrInvalidParam
+	}
+	for _, value := range values {
+		if value == v {
+			return &v, nil
+		}
+	}
+	return nil, errs.ErrInvalidParam
+}
+
+// parseTime accepts a date or a datetime in local time.
+// If end is true, a date means the end of that day.
+func parseTime(s string, end bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, errs.ErrInvalidParam
+	}
+	if end {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+func encodeCursor(cursor *models.UserCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string, cursor *models.UserCursor) error {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return errs.ErrInvalidParam
+	}
+	if err = json.Unmarshal(data, cursor); err != nil {
+		return errs.ErrInvalidParam
+	}
+	return nil
+}
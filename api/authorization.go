@@ -0,0 +1,355 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/core/cache"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/models"
+	"github.com/go-pandora/core/util/randutil"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+/*
+	Pandora as an OAuth 2.0 authorization server (RFC 6749).
+	Frontend of Pandora shows the consent screen, apps redeem codes at the token endpoint in routers.
+*/
+
+// OAuthError is an error response of token, introspection and revocation endpoints.
+// They answer apps in the format of RFC 6749 instead of ErrorResponse, which OAuth libraries understand.
+type OAuthError struct {
+	Status      int    `json:"-"`
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code
+}
+
+var (
+	ErrOAuthInvalidRequest       = &OAuthError{Status: http.StatusBadRequest, Code: "invalid_request"}
+	ErrOAuthInvalidClient        = &OAuthError{Status: http.StatusUnauthorized, Code: "invalid_client"}
+	ErrOAuthInvalidGrant         = &OAuthError{Status: http.StatusBadRequest, Code: "invalid_grant"}
+	ErrOAuthUnauthorizedClient   = &OAuthError{Status: http.StatusBadRequest, Code: "unauthorized_client"}
+	ErrOAuthUnsupportedGrantType = &OAuthError{Status: http.StatusBadRequest, Code: "unsupported_grant_type"}
+	ErrOAuthInvalidScope         = &OAuthError{Status: http.StatusBadRequest, Code: "invalid_scope"}
+)
+
+// AbortOAuth answers an app with err, errors which are not OAuthError are left to the error handler.
+func AbortOAuth(c *gin.Context, err error) {
+	e, ok := err.(*OAuthError)
+	if !ok {
+		c.Set("error", err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	if e == ErrOAuthInvalidClient {
+		c.Header("WWW-Authenticate", `Basic realm="pandora"`)
+	}
+	c.JSON(e.Status, e)
+}
+
+type clientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	Confidential bool     `json:"confidential"`
+}
+
+// AddClient registers an app, secret of a confidential app is only returned here.
+func AddClient(c *gin.Context) {
+	var (
+		req clientRequest
+		err error
+	)
+	defer func() { c.Set("error", err) }()
+
+	if err = BindJSON(c, &req); err != nil {
+		return
+	}
+	client := &models.OAuthClient{
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		Scopes:       req.Scopes,
+		Confidential: req.Confidential,
+	}
+	secret, err := client.AddClient()
+	if err != nil {
+		return
+	}
+	data := gin.H{"client": client}
+	if secret != "" {
+		data["client_secret"] = secret
+	}
+	c.JSON(http.StatusOK, Response{Data: data})
+}
+
+// GetClients lists all registered apps.
+func GetClients(c *gin.Context) {
+	clients, err := models.GetClients()
+	if err != nil {
+		c.Set("error", err)
+		return
+	}
+	c.JSON(http.StatusOK, Response{Data: clients})
+}
+
+// DeleteClient removes an app, all tokens issued to it are revoked.
+func DeleteClient(c *gin.Context) {
+	clientId := c.Param("client")
+	if err := models.DeleteClient(clientId); err != nil {
+		c.Set("error", err)
+		return
+	}
+	if err := cache.RevokeJWT(cache.ClientJWTKey(clientId, 0)); err != nil {
+		c.Set("error", errs.New(err))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// ResetClientSecret replaces secret of a confidential app, in case it has leaked.
+// All tokens issued to the app are revoked.
+func ResetClientSecret(c *gin.Context) {
+	clientId := c.Param("client")
+	secret, err := models.ResetClientSecret(clientId)
+	if err != nil {
+		c.Set("error", err)
+		return
+	}
+	if err = cache.RevokeJWT(cache.ClientJWTKey(clientId, 0)); err != nil {
+		c.Set("error", errs.New(err))
+		return
+	}
+	c.JSON(http.StatusOK, Response{Data: gin.H{"client_secret": secret}})
+}
+
+type authorizationRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientId            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Approve             bool   `json:"approve"`
+}
+
+// GetAuthorizationRequest checks an authorization request of an app, with parameters of RFC 6749 in query,
+// and tells frontend what to show on the consent screen.
+// If user has consented to all requested scope before, frontend may approve it without asking again.
+func GetAuthorizationRequest(c *gin.Context) {
+	var err error
+	defer func() { c.Set("error", err) }()
+
+	uid, err := strconv.ParseInt(c.GetString("user_id"), 10, 64)
+	if err != nil {
+		err = errs.ErrUnauthenticated
+		return
+	}
+	req := authorizationRequest{
+		ResponseType:        c.Query("response_type"),
+		ClientId:            c.Query("client_id"),
+		RedirectURI:         c.Query("redirect_uri"),
+		Scope:               c.Query("scope"),
+		State:               c.Query("state"),
+		CodeChallenge:       c.Query("code_challenge"),
+		CodeChallengeMethod: c.Query("code_challenge_method"),
+	}
+	client, err := checkAuthorizationRequest(&req)
+	if err != nil {
+		return
+	}
+	granted, err := models.GetConsent(uid, client.ClientId)
+	if err != nil {
+		return
+	}
+	c.JSON(http.StatusOK, Response{Data: gin.H{
+		"client_id":    client.ClientId,
+		"name":         client.Name,
+		"redirect_uri": req.RedirectURI,
+		"scope":        req.Scope,
+		"consented":    granted != "" && models.CoversScope(granted, req.Scope),
+	}})
+}
+
+// Authorize answers an authorization request by the choice of user on the consent screen.
+// Frontend redirects user to the returned URI, which carries an authorization code if user approves,
+// or error "access_denied" if he denies.
+func Authorize(c *gin.Context) {
+	var (
+		req authorizationRequest
+		err error
+	)
+	defer func() { c.Set("error", err) }()
+
+	uid, err := strconv.ParseInt(c.GetString("user_id"), 10, 64)
+	if err != nil {
+		err = errs.ErrUnauthenticated
+		return
+	}
+	if err = BindJSON(c, &req); err != nil {
+		return
+	}
+	explicit := req.RedirectURI != ""
+	client, err := checkAuthorizationRequest(&req)
+	if err != nil {
+		return
+	}
+
+	query := url.Values{}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	if !req.Approve {
+		query.Set("error", "access_denied")
+		c.JSON(http.StatusOK, Response{Data: gin.H{"redirect_uri": withQuery(req.RedirectURI, query)}})
+		return
+	}
+	if err = models.GrantConsent(uid, client.ClientId, req.Scope); err != nil {
+		return
+	}
+	code, err := randutil.Token(32)
+	if err != nil {
+		err = errs.New(err)
+		return
+	}
+	if err = cache.SetAuthorizationCode(code, &cache.AuthorizationCode{
+		ClientId:         client.ClientId,
+		UserId:           uid,
+		RedirectURI:      req.RedirectURI,
+		Scope:            req.Scope,
+		Challenge:        req.CodeChallenge,
+		RedirectExplicit: explicit,
+	}); err != nil {
+		err = errs.New(err)
+		return
+	}
+	query.Set("code", code)
+	c.JSON(http.StatusOK, Response{Data: gin.H{"redirect_uri": withQuery(req.RedirectURI, query)}})
+}
+
+// checkAuthorizationRequest validates an authorization request, and fills in redirect URI and scope if omitted.
+// Errors are shown to user rather than sent to redirect URI, since frontend of Pandora handles them.
+func checkAuthorizationRequest(req *authorizationRequest) (*models.OAuthClient, error) {
+	if req.ResponseType != "code" {
+		return nil, errs.ErrInvalidParam
+	}
+	client, err := models.GetClient(req.ClientId)
+	if err != nil {
+		return nil, err
+	}
+	if req.RedirectURI == "" && len(client.RedirectURIs) == 1 {
+		req.RedirectURI = client.RedirectURIs[0]
+	}
+	if !client.HasRedirectURI(req.RedirectURI) {
+		return nil, errs.ErrInvalidRedirectURI
+	}
+	// PKCE is required even for confidential apps, as recommended by OAuth 2.0 Security Best Current Practice.
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return nil, errs.ErrPKCERequired
+	}
+	if req.Scope, err = client.ParseScope(req.Scope); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// AuthenticateClient authenticates an app at token, introspection and revocation endpoints,
+// by HTTP basic authentication or client_id and client_secret in form.
+// A public app only provides client_id, and can't use endpoints which require confidential apps.
+func AuthenticateClient(c *gin.Context) (*models.OAuthClient, error) {
+	clientId, secret, basic := c.Request.BasicAuth()
+	if basic {
+		// credentials are form encoded before basic authentication, see section 2.3.1 of RFC 6749.
+		clientId, _ = url.QueryUnescape(clientId)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientId, secret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+	if clientId == "" {
+		return nil, ErrOAuthInvalidClient
+	}
+	client, err := models.GetClient(clientId)
+	if err == errs.ErrClientNotFound {
+		return nil, ErrOAuthInvalidClient
+	} else if err != nil {
+		return nil, err
+	}
+	if client.Confidential && !client.Authenticate(secret) {
+		return nil, ErrOAuthInvalidClient
+	}
+	if !client.Confidential && secret != "" {
+		return nil, ErrOAuthInvalidClient
+	}
+	return client, nil
+}
+
+// RedeemAuthorizationCode checks code in form is issued to client, and its PKCE code verifier matches the challenge.
+// Redirect URI must be the same as in the authorization request, it may be omitted only if the request omitted it,
+// see section 4.1.3 of RFC 6749.
+func RedeemAuthorizationCode(c *gin.Context, client *models.OAuthClient) (*cache.AuthorizationCode, error) {
+	code, err := cache.ConsumeAuthorizationCode(c.PostForm("code"))
+	if err == errs.ErrInvalidToken {
+		return nil, ErrOAuthInvalidGrant
+	} else if err != nil {
+		return nil, err
+	}
+	if code.ClientId != client.ClientId {
+		return nil, ErrOAuthInvalidGrant
+	}
+	if redirect := c.PostForm("redirect_uri"); (redirect != "" || code.RedirectExplicit) && redirect != code.RedirectURI {
+		return nil, ErrOAuthInvalidGrant
+	}
+	if !verifyCodeChallenge(c.PostForm("code_verifier"), code.Challenge) {
+		return nil, ErrOAuthInvalidGrant
+	}
+	return code, nil
+}
+
+// verifyCodeChallenge checks a PKCE code verifier against its S256 challenge, see section 4.6 of RFC 7636.
+func verifyCodeChallenge(verifier string, challenge string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// GetAuthorizedApps lists apps which the authenticated user has consented to.
+func GetAuthorizedApps(c *gin.Context) {
+	apps, err := models.GetAuthorizedApps(c.GetInt64("id"))
+	if err != nil {
+		c.Set("error", err)
+		return
+	}
+	c.JSON(http.StatusOK, Response{Data: apps})
+}
+
+// RevokeAuthorizedApp takes back consent of the authenticated user from an app,
+// and revokes all tokens issued to the app on behalf of him.
+func RevokeAuthorizedApp(c *gin.Context) {
+	id, clientId := c.GetInt64("id"), c.Param("client")
+	if err := models.RevokeConsent(id, clientId); err != nil {
+		c.Set("error", err)
+		return
+	}
+	if err := cache.RevokeJWT(cache.ClientJWTKey(clientId, id)); err != nil {
+		c.Set("error", errs.New(err))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func withQuery(uri string, query url.Values) string {
+	u, _ := url.Parse(uri)
+	values := u.Query()
+	for k, v := range query {
+		values[k] = v
+	}
+	u.RawQuery = values.Encode()
+	return u.String()
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/core/cache"
+	"github.com/go-pandora/core/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func formContext(form url.Values, setup func(r *http.Request)) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if setup != nil {
+		setup(c.Request)
+	}
+	return c
+}
+
+func s256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	// example of appendix B of RFC 7636.
+	verifier, challenge := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk", "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	assert.True(t, verifyCodeChallenge(verifier, challenge))
+	assert.True(t, verifyCodeChallenge("a-long-enough-code-verifier-for-the-test", s256("a-long-enough-code-verifier-for-the-test")))
+	assert.False(t, verifyCodeChallenge(verifier+"x", challenge))
+	assert.False(t, verifyCodeChallenge(verifier, verifier)) // plain method is not accepted
+	assert.False(t, verifyCodeChallenge("", challenge))
+	assert.False(t, verifyCodeChallenge(verifier, ""))
+}
+
+func TestRedeemAuthorizationCode(t *testing.T) {
+	if err := cache.Ping(); err != nil {
+		t.Skip("Redis is not available: " + err.Error())
+	}
+	client := &models.OAuthClient{ClientId: "test-redeem-client"}
+	redirect, verifier := "https://app.example.com/callback", "a-long-enough-code-verifier-for-the-test"
+	tests := []struct {
+		name     string
+		explicit bool // whether redirect URI was in the authorization request
+		client   string
+		form     url.Values
+		err      error
+	}{
+		{"valid", true, client.ClientId,
+			url.Values{"redirect_uri": {redirect}, "code_verifier": {verifier}}, nil},
+		{"redirect omitted but it was sent", true, client.ClientId,
+			url.Values{"code_verifier": {verifier}}, ErrOAuthInvalidGrant},
+		{"redirect omitted in both", false, client.ClientId,
+			url.Values{"code_verifier": {verifier}}, nil},
+		{"redirect differs", false, client.ClientId,
+			url.Values{"redirect_uri": {redirect + "/other"}, "code_verifier": {verifier}}, ErrOAuthInvalidGrant},
+		{"wrong verifier", true, client.ClientId,
+			url.Values{"redirect_uri": {redirect}, "code_verifier": {"wrong"}}, ErrOAuthInvalidGrant},
+		{"code of another app", true, "another-client",
+			url.Values{"redirect_uri": {redirect}, "code_verifier": {verifier}}, ErrOAuthInvalidGrant},
+	}
+	for _, test := range tests {
+		code := "test-code-" + strings.Replace(test.name, " ", "-", -1)
+		if err := cache.SetAuthorizationCode(code, &cache.AuthorizationCode{
+			ClientId:         test.client,
+			UserId:           1,
+			RedirectURI:      redirect,
+			Scope:            "profile",
+			Challenge:        s256(verifier),
+			RedirectExplicit: test.explicit,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		test.form.Set("code", code)
+		redeemed, err := RedeemAuthorizationCode(formContext(test.form, nil), client)
+		assert.Equal(t, test.err, err, test.name)
+		if err == nil {
+			assert.Equal(t, int64(1), redeemed.UserId, test.name)
+			assert.Equal(t, "profile", redeemed.Scope, test.name)
+		}
+
+		// a code can only be redeemed once.
+		_, err = RedeemAuthorizationCode(formContext(test.form, nil), client)
+		assert.Equal(t, ErrOAuthInvalidGrant, err, test.name)
+	}
+}
+
+func TestAuthenticateClient(t *testing.T) {
+	if err := models.Ping(); err != nil {
+		t.Skip("database is not available: " + err.Error())
+	}
+	confidential := &models.OAuthClient{Name: "backend", RedirectURIs: []string{"https://app.example.com/cb"}, Confidential: true}
+	secret, err := confidential.AddClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer models.DeleteClient(confidential.ClientId)
+	public := &models.OAuthClient{Name: "spa", RedirectURIs: []string{"https://app.example.com/cb"}}
+	if _, err = public.AddClient(); err != nil {
+		t.Fatal(err)
+	}
+	defer models.DeleteClient(public.ClientId)
+
+	basic := func(id, secret string) func(r *http.Request) {
+		return func(r *http.Request) { r.SetBasicAuth(url.QueryEscape(id), url.QueryEscape(secret)) }
+	}
+	tests := []struct {
+		name     string
+		form     url.Values
+		setup    func(r *http.Request)
+		expected string
+	}{
+		{"basic", url.Values{}, basic(confidential.ClientId, secret), confidential.ClientId},
+		{"form", url.Values{"client_id": {confidential.ClientId}, "client_secret": {secret}}, nil, confidential.ClientId},
+		{"wrong secret", url.Values{}, basic(confidential.ClientId, "wrong"), ""},
+		{"no secret of confidential app", url.Values{"client_id": {confidential.ClientId}}, nil, ""},
+		{"public app", url.Values{"client_id": {public.ClientId}}, nil, public.ClientId},
+		{"secret of public app", url.Values{"client_id": {public.ClientId}, "client_secret": {"x"}}, nil, ""},
+		{"unknown app", url.Values{"client_id": {"unknown"}}, nil, ""},
+		{"no app", url.Values{}, nil, ""},
+	}
+	for _, test := range tests {
+		client, err := AuthenticateClient(formContext(test.form, test.setup))
+		if test.expected == "" {
+			assert.Equal(t, ErrOAuthInvalidClient, err, test.name)
+			continue
+		}
+		if assert.Nil(t, err, test.name) {
+			assert.Equal(t, test.expected, client.ClientId, test.name)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/core/errs"
+)
+
+// BindJSON binds request body to obj.
+// If body is not valid json, ErrInvalidData is returned, with the field of wrong type in details if possible.
+func BindJSON(c *gin.Context, obj interface{}) error {
+	if err := c.ShouldBindJSON(obj); err != nil {
+		if e, ok := err.(*json.UnmarshalTypeError); ok && e.Field != "" {
+			return errs.ErrInvalidData.WithDetails(errs.Field(e.Field, errs.ErrInvalidData))
+		}
+		return errs.ErrInvalidData
+	}
+	return nil
+}
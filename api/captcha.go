@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/base64"
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/core/cache"
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/util/captcha"
+	"github.com/go-pandora/core/util/randutil"
+	"net/http"
+)
+
+// Headers which carry the captcha answered by user.
+const (
+	HeaderCaptchaId     = "X-Captcha-Id"
+	HeaderCaptchaAnswer = "X-Captcha-Answer"
+)
+
+// GetCaptcha creates a captcha, whose image is a PNG encoded as a data URL.
+// User should answer it by X-Captcha-Id and X-Captcha-Answer headers.
+func GetCaptcha(c *gin.Context) {
+	var err error
+	defer func() { c.Set("error", err) }()
+
+	answer, err := randutil.Digits(Config.CaptchaLength)
+	if err != nil {
+		err = errs.New(err)
+		return
+	}
+	image, err := captcha.PNG(answer, Config.CaptchaWidth, Config.CaptchaHeight)
+	if err != nil {
+		err = errs.New(err)
+		return
+	}
+	id, err := randutil.Token(16)
+	if err != nil {
+		err = errs.New(err)
+		return
+	}
+	if err = cache.SetCaptcha(id, answer); err != nil {
+		err = errs.New(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Data: gin.H{
+		"captcha_id": id,
+		"image":      "data:image/png;base64," + base64.StdEncoding.EncodeToString(image),
+		"expire_in":  int(Config.CaptchaTimeout.Seconds()),
+	}})
+}
+
+// CheckCaptcha checks the captcha answered in headers of request.
+func CheckCaptcha(c *gin.Context) error {
+	id, answer := c.GetHeader(HeaderCaptchaId), c.GetHeader(HeaderCaptchaAnswer)
+	if id == "" || answer == "" {
+		return errs.ErrCaptchaRequired
+	}
+	return cache.VerifyCaptcha(id, answer)
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/core/cache"
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/models"
+	"github.com/go-pandora/core/notify"
+	"github.com/go-pandora/core/util/randutil"
+	"github.com/go-pandora/core/util/validation"
+	"log"
+	"net/http"
+)
+
+type emailChangeRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"` // current password, so that a stolen token can't take over the account
+}
+
+// RequestEmailChange sends a confirmation link to the new email address of the authenticated user,
+// and a notice to the current one. Email address is changed only after the link is clicked.
+// User has to provide the current password.
+func RequestEmailChange(c *gin.Context) {
+	var (
+		req  emailChangeRequest
+		user models.User
+		err  error
+	)
+	defer func() { c.Set("error", err) }()
+
+	if err = BindJSON(c, &req); err != nil {
+		return
+	}
+	if validation.ValidateEmail(req.Email) != nil {
+		err = errs.ErrInvalidEmail
+		return
+	}
+	if err = models.VerifyPassword(c.GetInt64("id"), req.Password); err != nil {
+		return
+	}
+	if err = models.CheckEmailUnused(req.Email); err != nil {
+		return
+	}
+	if err = user.GetAccount(c.GetInt64("id")); err != nil {
+		return
+	}
+
+	token, err := randutil.Token(32)
+	if err != nil {
+		err = errs.New(err)
+		return
+	}
+	if err = cache.SetEmailChange(user.Id, req.Email, token); err != nil {
+		err = errs.New(err)
+		return
+	}
+	if err = notify.SendMail(&notify.Mail{
+		To:       req.Email,
+		Subject:  "Confirm your new email address",
+		Template: "change_email.html",
+		Data: map[string]string{
+			"name":   user.Username,
+			"link":   Config.BaseURL + "/auth/email/confirm?token=" + token,
+			"expire": Config.EmailChangeTimeout.String(),
+		},
+	}); err != nil {
+		err = errs.New(err)
+		return
+	}
+
+	if user.Email != nil {
+		if e := notify.SendMail(&notify.Mail{
+			To:       *user.Email,
+			Subject:  "Your email address is being changed",
+			Template: "email_change_notice.html",
+			Data: map[string]string{
+				"name":  user.Username,
+				"email": req.Email,
+			},
+		}); e != nil {
+			log.Printf("failed to send email change notice to user %d: %s", user.Id, e)
+		}
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// ConfirmEmailChange consumes a confirmation token and applies the pending email change.
+func ConfirmEmailChange(c *gin.Context) {
+	var err error
+	defer func() { c.Set("error", err) }()
+
+	token := c.Query("token")
+	if token == "" {
+		err = errs.ErrInvalidToken
+		return
+	}
+
+	id, email, err := cache.ConsumeEmailChange(token)
+	if err != nil {
+		return
+	}
+	user := models.User{Email: &email}
+	user.Id = id
+	if err = user.ChangeEmail(); err != nil {
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
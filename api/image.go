@@ -15,7 +15,7 @@ func UploadAvatar(c *gin.Context) {
 
 	file, err := c.FormFile("avatar")
 	if err != nil {
-		c.Status(http.StatusBadRequest)
+		err = errs.ErrInvalidImage
 		return
 	}
 
@@ -34,7 +34,7 @@ func UploadAvatar(c *gin.Context) {
 
 	fileType := http.DetectContentType(buffer)
 	if fileType != "image/jpeg" && fileType != "image/jpg" && fileType != "image/png" {
-		c.String(http.StatusBadRequest, fmt.Sprintf("%s", "avatar must be jpg or png file"))
+		err = errs.ErrInvalidImage
 		return
 	}
 
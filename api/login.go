@@ -0,0 +1,155 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/core/cache"
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/models"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Login checks credentials of user, and failed logins are throttled per account and per IP.
+// After a few failures a captcha is required, see CheckCaptcha,
+// and once the account or the IP is locked, ErrTooManyAttempts is returned with a Retry-After header.
+func Login(c *gin.Context, user *models.User) error {
+	account := loginAccount(user)
+	if account == "" {
+		return errs.ErrInfoRequired
+	}
+	// Failures of a known user are counted together, no matter whether email address, cellphone number
+	// or username is used. Unknown accounts are counted by what user logs in with.
+	uid, err := models.GetLoginUserId(user.Email, user.Cellphone, user.Username)
+	if err != nil {
+		return err
+	}
+	accountKey := cache.LoginAccountKey(account)
+	if uid != 0 {
+		accountKey = cache.LoginUserKey(uid)
+	}
+	keys := []string{accountKey, cache.LoginIPKey(c.ClientIP())}
+	thresholds := []int{Config.AccountThreshold, Config.IPThreshold}
+
+	captchaRequired := false
+	for _, key := range keys {
+		lock, err := cache.LoginLocked(key)
+		if err != nil {
+			return errs.New(err)
+		}
+		if lock > 0 {
+			return tooManyAttempts(c, lock)
+		}
+		failures, err := cache.LoginFailures(key)
+		if err != nil {
+			return errs.New(err)
+		}
+		captchaRequired = captchaRequired || failures >= Config.CaptchaThreshold
+	}
+	if captchaRequired {
+		if err := CheckCaptcha(c); err != nil {
+			return err
+		}
+	}
+
+	err = user.Login()
+	switch err {
+	case errs.ErrWrongPassword, errs.ErrUserNotFound:
+		// Unknown accounts are counted as well, so that they can't be told from locked ones.
+		for i, key := range keys {
+			if _, e := cache.RecordLoginFailure(key, thresholds[i]); e != nil {
+				return errs.New(e)
+			}
+		}
+	case nil, errs.ErrPasswordExpired:
+		// Failures are only forgotten once the second factor is verified as well,
+		// otherwise whoever knows the password could guess codes endlessly.
+		status, e := models.GetMFAStatus(user.Id)
+		if e != nil {
+			return e
+		}
+		if status.Enabled || status.Required {
+			break
+		}
+		if e := cache.ClearLoginFailures(keys[0]); e != nil {
+			return errs.New(e)
+		}
+	}
+	return err
+}
+
+// checkLoginLock refuses the second step of login while user is locked by failed logins.
+func checkLoginLock(c *gin.Context, uid int64) error {
+	lock, err := cache.LoginLocked(cache.LoginUserKey(uid))
+	if err != nil {
+		return errs.New(err)
+	}
+	if lock > 0 {
+		return tooManyAttempts(c, lock)
+	}
+	return nil
+}
+
+// recordLoginFailure counts a wrong second factor as a failed login of user.
+func recordLoginFailure(uid int64) error {
+	if _, err := cache.RecordLoginFailure(cache.LoginUserKey(uid), Config.AccountThreshold); err != nil {
+		return errs.New(err)
+	}
+	return nil
+}
+
+// loginAccount names the account which user tries to log in, empty if user provides nothing to log in with.
+func loginAccount(user *models.User) string {
+	switch {
+	case user.Email != nil:
+		return "email:" + strings.ToLower(*user.Email)
+	case user.Cellphone != nil:
+		return "cellphone:" + *user.Cellphone
+	case user.Username != "":
+		return "username:" + strings.ToLower(user.Username)
+	default:
+		return ""
+	}
+}
+
+func tooManyAttempts(c *gin.Context, lock time.Duration) error {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(lock.Seconds()))))
+	return errs.ErrTooManyAttempts
+}
+
+// ClearLoginLockout lifts the lock of an account caused by failed logins.
+// If query "ip" is provided, the lock of that IP is lifted as well.
+func ClearLoginLockout(c *gin.Context) {
+	var (
+		user models.User
+		err  error
+	)
+	defer func() { c.Set("error", err) }()
+
+	if err = user.GetAccount(c.GetInt64("id")); err != nil {
+		return
+	}
+
+	keys := []string{
+		cache.LoginUserKey(user.Id),
+		cache.LoginAccountKey(loginAccount(&models.User{Username: user.Username})),
+	}
+	if user.Email != nil {
+		keys = append(keys, cache.LoginAccountKey(loginAccount(&models.User{Email: user.Email})))
+	}
+	if user.Cellphone != nil {
+		keys = append(keys, cache.LoginAccountKey(loginAccount(&models.User{Cellphone: user.Cellphone})))
+	}
+	if ip := c.Query("ip"); ip != "" {
+		keys = append(keys, cache.LoginIPKey(ip))
+	}
+	if err = cache.ClearLoginFailures(keys...); err != nil {
+		err = errs.New(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
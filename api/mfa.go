@@ -0,0 +1,179 @@
+package api
+
+import (
+	"encoding/base64"
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/core/cache"
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/models"
+	"github.com/skip2/go-qrcode"
+	"log"
+	"net/http"
+)
+
+type mfaRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"` // a TOTP code or a recovery code
+}
+
+// GetMFAStatus tells whether the authenticated user has enabled two-factor authentication.
+func GetMFAStatus(c *gin.Context) {
+	status, err := models.GetMFAStatus(c.GetInt64("id"))
+	if err != nil {
+		c.Set("error", err)
+		return
+	}
+	c.JSON(http.StatusOK, Response{Data: status})
+}
+
+// EnrollMFA generates a TOTP secret for the authenticated user.
+// Two-factor authentication is enabled once a first code is confirmed by ConfirmMFA.
+func EnrollMFA(c *gin.Context) {
+	if err := enrollMFA(c, c.GetInt64("id")); err != nil {
+		c.Set("error", err)
+	}
+}
+
+// ConfirmMFA enables two-factor authentication of the authenticated user by a first code,
+// and returns recovery codes which won't be shown again.
+func ConfirmMFA(c *gin.Context) {
+	var (
+		req mfaRequest
+		err error
+	)
+	defer func() { c.Set("error", err) }()
+
+	if err = BindJSON(c, &req); err != nil {
+		return
+	}
+	codes, err := models.ConfirmMFA(c.GetInt64("id"), req.Code)
+	if err != nil {
+		return
+	}
+	c.JSON(http.StatusOK, Response{Data: gin.H{"recovery_codes": codes}})
+}
+
+// DisableMFA turns off two-factor authentication of the authenticated user, which needs a code.
+func DisableMFA(c *gin.Context) {
+	var (
+		req mfaRequest
+		err error
+	)
+	defer func() { c.Set("error", err) }()
+
+	if err = BindJSON(c, &req); err != nil {
+		return
+	}
+	if err = models.DisableMFA(c.GetInt64("id"), req.Code); err != nil {
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// StartMFA checks whether login of user needs a second step.
+// If so, it writes a pending token to response instead of credentials, and returns true.
+// "mfa_enroll" tells client that user is required to enroll before completing the login.
+func StartMFA(c *gin.Context, uid int64) (bool, error) {
+	status, err := models.GetMFAStatus(uid)
+	if err != nil {
+		return false, err
+	}
+	if !status.Enabled && !status.Required {
+		return false, nil
+	}
+	token, err := cache.CreateMFAPending(uid)
+	if err != nil {
+		return false, errs.New(err)
+	}
+	c.JSON(http.StatusOK, Response{Data: gin.H{
+		"mfa_required": true,
+		"mfa_token":    token,
+		"mfa_enroll":   !status.Enabled,
+		"expire_in":    int(Config.MFAPendingTimeout.Seconds()),
+	}})
+	return true, nil
+}
+
+// EnrollPendingMFA generates a TOTP secret for user whose login is pending on enrollment,
+// which is confirmed by the first code sent to the second step of login.
+func EnrollPendingMFA(c *gin.Context) {
+	var (
+		req mfaRequest
+		err error
+	)
+	defer func() { c.Set("error", err) }()
+
+	if err = BindJSON(c, &req); err != nil {
+		return
+	}
+	uid, err := cache.GetMFAPending(req.MFAToken)
+	if err != nil {
+		return
+	}
+	err = enrollMFA(c, uid)
+}
+
+// CompleteMFA checks the second factor of a pending login, and returns the user who logs in.
+// If user is enrolling, the code enables two-factor authentication and recovery codes are returned.
+func CompleteMFA(c *gin.Context) (int64, []string, error) {
+	var req mfaRequest
+	if err := BindJSON(c, &req); err != nil {
+		return 0, nil, err
+	}
+	uid, err := cache.GetMFAPending(req.MFAToken)
+	if err != nil {
+		return 0, nil, err
+	}
+	// a new pending login doesn't allow more guesses, since wrong codes count as failed logins of user.
+	if err = checkLoginLock(c, uid); err != nil {
+		return 0, nil, err
+	}
+	status, err := models.GetMFAStatus(uid)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var codes []string
+	if status.Enabled {
+		err = models.VerifyMFA(uid, req.Code)
+	} else {
+		codes, err = models.ConfirmMFA(uid, req.Code)
+	}
+	if err == errs.ErrInvalidCode {
+		if err := cache.RecordMFAFailure(req.MFAToken); err != nil {
+			log.Printf("failed to record mfa failure: %s", err)
+		}
+		if err := recordLoginFailure(uid); err != nil {
+			return 0, nil, err
+		}
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if err = cache.ConsumeMFAPending(req.MFAToken); err != nil {
+		return 0, nil, err
+	}
+	if err = cache.ClearLoginFailures(cache.LoginUserKey(uid)); err != nil {
+		return 0, nil, errs.New(err)
+	}
+	return uid, codes, nil
+}
+
+// enrollMFA writes a new TOTP secret of user along with its provisioning URI and QR code.
+func enrollMFA(c *gin.Context, uid int64) error {
+	secret, uri, err := models.EnrollMFA(uid)
+	if err != nil {
+		return err
+	}
+	image, err := qrcode.Encode(uri, qrcode.Medium, Config.QRSize)
+	if err != nil {
+		return errs.New(err)
+	}
+	c.JSON(http.StatusOK, Response{Data: gin.H{
+		"secret": secret,
+		"uri":    uri,
+		"image":  "data:image/png;base64," + base64.StdEncoding.EncodeToString(image),
+	}})
+	return nil
+}
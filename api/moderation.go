@@ -0,0 +1,89 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/core/cache"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxModerationHours is about 100 years, a longer duration may overflow, use 0 for a permanent action instead.
+const maxModerationHours = 100 * 365 * 24
+
+type moderationRequest struct {
+	Reason string `json:"reason"`
+	Hours  int    `json:"hours"` // how long the action lasts, 0 means forever
+}
+
+// RestrictUser restricts a user, who can only read after logging in again.
+func RestrictUser(c *gin.Context) {
+	moderate(c, models.ActionRestrict)
+}
+
+// BanUser bans a user, who will be locked out immediately.
+func BanUser(c *gin.Context) {
+	moderate(c, models.ActionBan)
+}
+
+// RestoreUser lifts restriction or ban of a user.
+func RestoreUser(c *gin.Context) {
+	moderate(c, models.ActionRestore)
+}
+
+// ForceActivateUser activates a user without an activation link.
+func ForceActivateUser(c *gin.Context) {
+	moderate(c, models.ActionActivate)
+}
+
+// moderate takes an action on user and records the reason and acting administrator.
+func moderate(c *gin.Context, action string) {
+	var (
+		req moderationRequest
+		err error
+	)
+	defer func() { c.Set("error", err) }()
+
+	if err = BindJSON(c, &req); err != nil {
+		return
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		err = errs.ErrReasonRequired
+		return
+	}
+	if req.Hours < 0 || req.Hours > maxModerationHours {
+		err = errs.ErrInvalidParam
+		return
+	}
+
+	id := c.GetInt64("id")
+	adminId, _ := strconv.ParseInt(c.GetString("user_id"), 10, 64)
+	m := models.Moderation{UserId: id, AdminId: adminId, Action: action, Reason: req.Reason}
+	if req.Hours > 0 {
+		m.ExpireAt = models.JsonTime(time.Now().Add(time.Duration(req.Hours) * time.Hour))
+	}
+	if err = m.Moderate(); err != nil {
+		return
+	}
+
+	if action == models.ActionRestrict || action == models.ActionBan {
+		if err = cache.RevokeJWT(strconv.FormatInt(id, 10)); err != nil {
+			err = errs.New(err)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, Response{Data: m})
+}
+
+// GetModerations lists all actions taken on a user.
+func GetModerations(c *gin.Context) {
+	moderations, err := models.GetModerations(c.GetInt64("id"))
+	if err != nil {
+		c.Set("error", err)
+		return
+	}
+	c.JSON(http.StatusOK, Response{Data: moderations})
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/core/cache"
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/models"
+	"github.com/go-pandora/core/util/oauth"
+	"log"
+	"net/http"
+)
+
+var providers = make(map[string]*oauth.Provider)
+
+func init() {
+	for name, p := range Config.OAuthProviders {
+		providers[name] = &oauth.Provider{
+			Name:          name,
+			ClientID:      p.ClientID,
+			ClientSecret:  p.ClientSecret,
+			AuthStyle:     p.AuthStyle,
+			RedirectURL:   p.RedirectURL,
+			Scopes:        p.Scopes,
+			AuthURL:       p.AuthURL,
+			TokenURL:      p.TokenURL,
+			UserInfoURL:   p.UserInfoURL,
+			Issuer:        p.Issuer,
+			JWKSURL:       p.JWKSURL,
+			SubjectField:  p.SubjectField,
+			EmailField:    p.EmailField,
+			NameField:     p.NameField,
+			EmailVerified: p.EmailVerified,
+		}
+	}
+}
+
+type oauthCallback struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+// BeginOAuthLogin returns the URL where user authorizes login at provider.
+// Provider redirects user back to the configured redirect URL with code and state.
+func BeginOAuthLogin(c *gin.Context) {
+	if err := beginOAuth(c, 0); err != nil {
+		c.Set("error", err)
+	}
+}
+
+// BeginOAuthLink returns the URL where the authenticated user authorizes linking his account at provider.
+func BeginOAuthLink(c *gin.Context) {
+	if err := beginOAuth(c, c.GetInt64("id")); err != nil {
+		c.Set("error", err)
+	}
+}
+
+func beginOAuth(c *gin.Context, uid int64) error {
+	name := c.Param("provider")
+	provider, ok := providers[name]
+	if !ok {
+		return errs.ErrProviderNotFound
+	}
+	state, err := oauth.NewState()
+	if err != nil {
+		return errs.New(err)
+	}
+	nonce, err := oauth.NewState()
+	if err != nil {
+		return errs.New(err)
+	}
+	verifier, challenge, err := oauth.NewPKCE()
+	if err != nil {
+		return errs.New(err)
+	}
+	if err = cache.SetOAuthState(state, &cache.OAuthState{
+		Provider: name,
+		Verifier: verifier,
+		Nonce:    nonce,
+		UserId:   uid,
+	}); err != nil {
+		return errs.New(err)
+	}
+	c.JSON(http.StatusOK, Response{Data: gin.H{
+		"url":       provider.AuthCodeURL(state, nonce, challenge),
+		"expire_in": int(Config.OAuthStateTimeout.Seconds()),
+	}})
+	return nil
+}
+
+// LoginByOAuth logs in by an external account, with code and state which provider redirects back with.
+// If the account has not been linked, a new user is created for it, or it is linked to the user
+// with the same verified email address if provider is trusted to do so.
+// Only an active user who has proved to own the address can be linked, otherwise whoever registered
+// the address first, without owning it, would take over the external account.
+func LoginByOAuth(c *gin.Context) (*models.User, error) {
+	identity, name, err := authorizeOAuth(c, 0)
+	if err != nil {
+		return nil, err
+	}
+	linked, err := identity.GetIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{}
+	if !linked && identity.Email != "" {
+		if models.CheckEmailUnused(identity.Email) == errs.ErrEmailUsed {
+			if !Config.OAuthProviders[identity.Provider].LinkByEmail {
+				return nil, errs.ErrAccountExists
+			}
+			user.Email = &identity.Email
+			if err = user.GetUserByContact(); err != nil {
+				return nil, err
+			}
+			if !user.EmailVerified {
+				return nil, errs.ErrAccountExists
+			}
+			// check status before linking, so that no link is left for a user who can't log in.
+			if err = user.LoginById(user.Id); err != nil {
+				return nil, err
+			}
+			if user.Status == models.Restricted {
+				return nil, errs.ErrUserRestricted
+			}
+			identity.UserId = user.Id
+			if err = identity.LinkIdentity(); err != nil {
+				return nil, err
+			}
+			return user, nil
+		}
+	}
+	if !linked {
+		if user, err = identity.AddUserByIdentity(name); err != nil {
+			return nil, err
+		}
+		identity.UserId = user.Id
+	}
+	if err = user.LoginById(identity.UserId); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// LinkOAuth links an external account to the authenticated user.
+func LinkOAuth(c *gin.Context) {
+	var err error
+	defer func() { c.Set("error", err) }()
+
+	id := c.GetInt64("id")
+	identity, _, err := authorizeOAuth(c, id)
+	if err != nil {
+		return
+	}
+	identity.UserId = id
+	if err = identity.LinkIdentity(); err != nil {
+		return
+	}
+	c.JSON(http.StatusOK, Response{Data: identity})
+}
+
+// GetIdentities lists external accounts linked to the authenticated user.
+func GetIdentities(c *gin.Context) {
+	identities, err := models.GetUserIdentities(c.GetInt64("id"))
+	if err != nil {
+		c.Set("error", err)
+		return
+	}
+	c.JSON(http.StatusOK, Response{Data: identities})
+}
+
+// UnlinkOAuth removes the external account of provider from the authenticated user.
+func UnlinkOAuth(c *gin.Context) {
+	if err := models.UnlinkIdentity(c.GetInt64("id"), c.Param("provider")); err != nil {
+		c.Set("error", err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// authorizeOAuth redeems code for the request started by user uid, and finds out who user is at provider.
+// Code and state are read from query if provider redirects to server directly, otherwise from body.
+// Email address of identity is only kept if provider has verified it, name of user at provider is also returned.
+func authorizeOAuth(c *gin.Context, uid int64) (*models.Identity, string, error) {
+	var req oauthCallback
+	if c.Request.Method == http.MethodGet {
+		if c.Query("error") != "" {
+			return nil, "", errs.ErrOAuthFailed
+		}
+		req.Code, req.State = c.Query("code"), c.Query("state")
+	} else if err := BindJSON(c, &req); err != nil {
+		return nil, "", err
+	}
+
+	name := c.Param("provider")
+	provider, ok := providers[name]
+	if !ok {
+		return nil, "", errs.ErrProviderNotFound
+	}
+	state, err := cache.ConsumeOAuthState(req.State)
+	if err != nil {
+		return nil, "", err
+	}
+	if state.Provider != name || state.UserId != uid {
+		return nil, "", errs.ErrInvalidToken
+	}
+
+	token, err := provider.Exchange(req.Code, state.Verifier)
+	if err != nil {
+		log.Printf("failed to log in with %s: %s", name, err)
+		return nil, "", errs.ErrOAuthFailed
+	}
+	external, err := provider.Identify(token, state.Nonce)
+	if err != nil {
+		log.Printf("failed to log in with %s: %s", name, err)
+		return nil, "", errs.ErrOAuthFailed
+	}
+
+	identity := &models.Identity{Provider: name, Subject: external.Subject}
+	if external.EmailVerified {
+		identity.Email = external.Email
+	}
+	return identity, external.Name, nil
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/core/cache"
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/models"
+	"github.com/go-pandora/core/notify"
+	"github.com/go-pandora/core/util/randutil"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+type passwordResetRequest struct {
+	Email     *string `json:"email"`
+	Cellphone *string `json:"cellphone"`
+	Code      string  `json:"code"`
+	Password  string  `json:"password"`
+}
+
+// ForgotPassword sends a password reset code to user's email address or cellphone.
+// It answers the same whether the address is registered or not, and whether a code is sent or throttled,
+// so that it can't tell who has an account.
+func ForgotPassword(c *gin.Context) {
+	var (
+		req passwordResetRequest
+		err error
+	)
+	defer func() { c.Set("error", err) }()
+
+	if err = BindJSON(c, &req); err != nil {
+		return
+	}
+
+	user := models.User{Email: req.Email, Cellphone: req.Cellphone}
+	if err = user.GetUserByContact(); err == errs.ErrUserNotFound {
+		log.Printf("password reset requested for unregistered contact, email: %v, cellphone: %v",
+			stringValue(req.Email), stringValue(req.Cellphone))
+		err = nil
+		c.Status(http.StatusOK)
+		return
+	} else if err != nil {
+		return
+	}
+
+	code, err := randutil.Digits(6)
+	if err != nil {
+		err = errs.New(err)
+		return
+	}
+	wait, err := cache.SetResetCode(user.Id, code)
+	if err != nil {
+		err = errs.New(err)
+		return
+	}
+	if wait > 0 {
+		log.Printf("password reset code of user %d is throttled for %s", user.Id, wait)
+		c.Status(http.StatusOK)
+		return
+	}
+
+	if req.Email != nil {
+		err = notify.SendMail(&notify.Mail{
+			To:       *user.Email,
+			Subject:  "Reset your Pandora password",
+			Template: "reset_password.html",
+			Data: map[string]string{
+				"name":   user.Username,
+				"code":   code,
+				"expire": Config.ResetTimeout.String(),
+			},
+		})
+	} else {
+		err = notify.SendSMS(*user.Cellphone,
+			fmt.Sprintf("[Pandora] Your password reset code is %s, it will expire in %s.", code, Config.ResetTimeout))
+	}
+	if err != nil {
+		err = errs.New(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// ResetPassword checks the reset code and sets a new password.
+// All tokens issued before will be revoked.
+func ResetPassword(c *gin.Context) {
+	var (
+		req passwordResetRequest
+		err error
+	)
+	defer func() { c.Set("error", err) }()
+
+	if err = BindJSON(c, &req); err != nil {
+		return
+	}
+
+	user := models.User{Email: req.Email, Cellphone: req.Cellphone}
+	if err = user.GetUserByContact(); err == errs.ErrUserNotFound {
+		// the same as a wrong code, nobody has been sent a code for this contact.
+		err = errs.ErrInvalidCode
+		return
+	} else if err != nil {
+		return
+	}
+	// Check password first, so that the code won't be wasted by an invalid password.
+	if err = models.ValidatePassword(req.Password, user.Username); err != nil {
+		return
+	}
+	if err = cache.ConsumeResetCode(user.Id, req.Code); err != nil {
+		return
+	}
+	if err = models.ResetPassword(user.Id, req.Password); err != nil {
+		return
+	}
+	if err = cache.RevokeJWT(strconv.FormatInt(user.Id, 10)); err != nil {
+		err = errs.New(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+type expiredPasswordRequest struct {
+	Email       *string `json:"email"`
+	Cellphone   *string `json:"cellphone"`
+	Password    string  `json:"password"`
+	NewPassword string  `json:"new_password"`
+	Code        string  `json:"code"` // a TOTP code or a recovery code, if two-factor authentication is enabled
+}
+
+// RenewExpiredPassword lets a user whose password has expired log in with it once to set a new one.
+// User who has enabled two-factor authentication has to provide a code as well.
+// User should login again with the new password afterwards.
+func RenewExpiredPassword(c *gin.Context) {
+	var (
+		req expiredPasswordRequest
+		err error
+	)
+	defer func() { c.Set("error", err) }()
+
+	if err = BindJSON(c, &req); err != nil {
+		return
+	}
+	user := models.User{Email: req.Email, Cellphone: req.Cellphone, Password: req.Password}
+	if err = Login(c, &user); err == nil {
+		err = errs.ErrPasswordNotExpired
+		return
+	} else if err != errs.ErrPasswordExpired {
+		return
+	}
+	if err = verifySecondFactor(user.Id, req.Code); err != nil {
+		return
+	}
+	if err = models.ChangePassword(user.Id, req.Password, req.NewPassword); err != nil {
+		return
+	}
+	if err = cache.RevokeJWT(strconv.FormatInt(user.Id, 10)); err != nil {
+		err = errs.New(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// verifySecondFactor checks a code of user who has enabled two-factor authentication.
+// Wrong codes count as failed logins of user, so that codes can't be guessed endlessly,
+// and failures are forgotten once the code is verified.
+func verifySecondFactor(uid int64, code string) error {
+	status, err := models.GetMFAStatus(uid)
+	if err != nil || !status.Enabled {
+		return err
+	}
+	if err = models.VerifyMFA(uid, code); err == errs.ErrInvalidCode {
+		if e := recordLoginFailure(uid); e != nil {
+			return e
+		}
+		return err
+	} else if err != nil {
+		return err
+	}
+	if err = cache.ClearLoginFailures(cache.LoginUserKey(uid)); err != nil {
+		return errs.New(err)
+	}
+	return nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/base64"
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/core/cache"
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/util/randutil"
+	"github.com/skip2/go-qrcode"
+	"net/http"
+	"strconv"
+)
+
+// CreateQRLogin creates a QR login ticket for web client.
+// QR code carries a link with the ticket, which should be scanned by a logged-in mobile app.
+// Secret is only known by web client, who needs it to get tokens once the ticket is confirmed.
+func CreateQRLogin(c *gin.Context) {
+	var err error
+	defer func() { c.Set("error", err) }()
+
+	ticket, err := randutil.Token(16)
+	if err != nil {
+		err = errs.New(err)
+		return
+	}
+	secret, err := randutil.Token(32)
+	if err != nil {
+		err = errs.New(err)
+		return
+	}
+	image, err := qrcode.Encode(Config.BaseURL+"/auth/qr/"+ticket, qrcode.Medium, Config.QRSize)
+	if err != nil {
+		err = errs.New(err)
+		return
+	}
+	if err = cache.CreateQRTicket(ticket, secret); err != nil {
+		err = errs.New(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Data: gin.H{
+		"ticket":    ticket,
+		"secret":    secret,
+		"image":     "data:image/png;base64," + base64.StdEncoding.EncodeToString(image),
+		"expire_in": int(Config.QRTicketTimeout.Seconds()),
+	}})
+}
+
+// ScanQRLogin tells web client that its QR code has been scanned by the authenticated user.
+func ScanQRLogin(c *gin.Context) {
+	qrLogin(c, cache.ScanQRTicket)
+}
+
+// ConfirmQRLogin authorizes web client to log in as the authenticated user.
+func ConfirmQRLogin(c *gin.Context) {
+	qrLogin(c, cache.ConfirmQRTicket)
+}
+
+func qrLogin(c *gin.Context, transit func(ticket string, uid int64) error) {
+	uid, err := strconv.ParseInt(c.GetString("user_id"), 10, 64)
+	if err != nil {
+		c.Set("error", errs.ErrUnauthenticated)
+		return
+	}
+	if err = transit(c.Param("ticket"), uid); err != nil {
+		c.Set("error", err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
@@ -2,7 +2,29 @@
 // A frontend should call required API through HTTP requests.
 package api
 
+import "github.com/go-pandora/core/errs"
+
 type Response struct {
-	Message string      `json:"message"`
-	Data    interface{} `json:"data"`
+	Message    string      `json:"message"`
+	Data       interface{} `json:"data"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+}
+
+// Pagination describes which part of a list is returned.
+// Page is only provided for offset pagination,
+// and next cursor is provided if there are more items.
+type Pagination struct {
+	Total      int64  `json:"total"`
+	Page       int    `json:"page,omitempty"`
+	PageSize   int    `json:"page_size"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ErrorResponse is returned whenever a request fails.
+// Code is the stable code of error, and details are provided if some fields of request are invalid.
+type ErrorResponse struct {
+	Code      int               `json:"code"`
+	Message   string            `json:"message"`
+	Details   []errs.FieldError `json:"details,omitempty"`
+	RequestId string            `json:"request_id"`
 }
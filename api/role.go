@@ -0,0 +1,90 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/core/cache"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/models"
+	"net/http"
+	"strconv"
+)
+
+// GetRoles lists all roles.
+func GetRoles(c *gin.Context) {
+	roles, err := models.GetRoles()
+	if err != nil {
+		c.Set("error", err)
+		return
+	}
+	c.JSON(http.StatusOK, Response{Data: roles})
+}
+
+// GetUserRoles lists roles of a user.
+func GetUserRoles(c *gin.Context) {
+	roles, err := models.GetUserRoles(c.GetInt64("id"))
+	if err != nil {
+		c.Set("error", err)
+		return
+	}
+	c.JSON(http.StatusOK, Response{Data: roles})
+}
+
+// AssignRole grants a role to user.
+// User will get the new role after refreshing his access token or logging in again.
+func AssignRole(c *gin.Context) {
+	if err := models.AssignRole(c.GetInt64("id"), c.Param("role")); err != nil {
+		c.Set("error", err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// RevokeRole takes a role back from user.
+// All tokens and sessions of user will be revoked, since they still carry the role.
+func RevokeRole(c *gin.Context) {
+	id := c.GetInt64("id")
+	if err := models.RevokeRole(id, c.Param("role")); err != nil {
+		c.Set("error", err)
+		return
+	}
+	if err := cache.RevokeJWT(strconv.FormatInt(id, 10)); err != nil {
+		c.Set("error", errs.New(err))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+type roleMFARequest struct {
+	Required bool `json:"required"`
+}
+
+// SetRoleMFA sets whether users of a role must log in with two-factor authentication.
+// Once it is required, tokens and sessions of users who haven't enabled it are revoked,
+// so that they have to enroll while logging in again.
+func SetRoleMFA(c *gin.Context) {
+	var (
+		req roleMFARequest
+		err error
+	)
+	defer func() { c.Set("error", err) }()
+
+	if err = BindJSON(c, &req); err != nil {
+		return
+	}
+	if err = models.SetRoleMFA(c.Param("role"), req.Required); err != nil {
+		return
+	}
+	if req.Required {
+		var ids []int64
+		if ids, err = models.GetUsersWithoutMFA(c.Param("role")); err != nil {
+			return
+		}
+		for _, id := range ids {
+			if err = cache.RevokeJWT(strconv.FormatInt(id, 10)); err != nil {
+				err = errs.New(err)
+				return
+			}
+		}
+	}
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/core/cache"
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/models"
+	"github.com/go-pandora/core/notify"
+	"github.com/go-pandora/core/util/randutil"
+	"github.com/go-pandora/core/util/validation"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+type cellphoneCodeRequest struct {
+	Cellphone string `json:"cellphone"`
+	Code      string `json:"code"`
+}
+
+// SendLoginCode sends a one-time login code to cellphone of an existing user.
+// It answers the same whether the number is registered or not, so that it can't tell who has an account.
+func SendLoginCode(c *gin.Context) {
+	var (
+		req cellphoneCodeRequest
+		err error
+	)
+	defer func() { c.Set("error", err) }()
+
+	if err = BindJSON(c, &req); err != nil {
+		return
+	}
+	if validation.ValidateCellphone(req.Cellphone) != nil {
+		err = errs.ErrInvalidCellphone
+		return
+	}
+	user := models.User{Cellphone: &req.Cellphone}
+	if err = user.GetUserByContact(); err == errs.ErrUserNotFound {
+		// codes are issued and throttled all the same, but never sent.
+		log.Printf("login code requested for unregistered cellphone %s", req.Cellphone)
+		if _, err = issueOTP(c, cache.OTPLogin, req.Cellphone); err != nil {
+			return
+		}
+		c.Status(http.StatusOK)
+		return
+	} else if err != nil {
+		return
+	}
+	if err = sendOTP(c, cache.OTPLogin, req.Cellphone); err != nil {
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// LoginByOTP checks the one-time login code sent to cellphone, and logs in its owner without password.
+func LoginByOTP(c *gin.Context) (*models.User, error) {
+	var req cellphoneCodeRequest
+	if err := BindJSON(c, &req); err != nil {
+		return nil, err
+	}
+	if err := cache.ConsumeOTP(cache.OTPLogin, req.Cellphone, req.Code); err != nil {
+		return nil, err
+	}
+	user := &models.User{Cellphone: &req.Cellphone}
+	if err := user.LoginByCellphone(); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// SendCellphoneCode sends a one-time code to the new cellphone number of the authenticated user.
+func SendCellphoneCode(c *gin.Context) {
+	var (
+		req cellphoneCodeRequest
+		err error
+	)
+	defer func() { c.Set("error", err) }()
+
+	if err = BindJSON(c, &req); err != nil {
+		return
+	}
+	if validation.ValidateCellphone(req.Cellphone) != nil {
+		err = errs.ErrInvalidCellphone
+		return
+	}
+	if err = sendOTP(c, verifyPurpose(c.GetInt64("id")), req.Cellphone); err != nil {
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// ChangeCellphone replaces cellphone number of the authenticated user once the number is verified.
+func ChangeCellphone(c *gin.Context) {
+	var (
+		req cellphoneCodeRequest
+		err error
+	)
+	defer func() { c.Set("error", err) }()
+
+	if err = BindJSON(c, &req); err != nil {
+		return
+	}
+	id := c.GetInt64("id")
+	if err = cache.ConsumeOTP(verifyPurpose(id), req.Cellphone, req.Code); err != nil {
+		return
+	}
+	user := models.User{Cellphone: &req.Cellphone}
+	user.Id = id
+	if err = user.ChangeCellphone(); err != nil {
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// verifyPurpose binds a verification code to user, so that nobody else can use it.
+func verifyPurpose(id int64) string {
+	return cache.OTPVerify + ":" + strconv.FormatInt(id, 10)
+}
+
+// sendOTP sends a one-time code to cellphone for purpose.
+// If codes are sent to cellphone too often, ErrTooManyRequests is returned with a Retry-After header.
+func sendOTP(c *gin.Context, purpose string, cellphone string) error {
+	code, err := issueOTP(c, purpose, cellphone)
+	if err != nil {
+		return err
+	}
+	if err = notify.SendSMS(cellphone,
+		fmt.Sprintf("[Pandora] Your verification code is %s, it will expire in %s.", code, Config.OTPTimeout)); err != nil {
+		return errs.New(err)
+	}
+	return nil
+}
+
+// issueOTP stores a new one-time code of cellphone for purpose, limited like sendOTP.
+func issueOTP(c *gin.Context, purpose string, cellphone string) (string, error) {
+	code, err := randutil.Digits(6)
+	if err != nil {
+		return "", errs.New(err)
+	}
+	wait, err := cache.SetOTP(purpose, cellphone, code)
+	if err != nil {
+		return "", errs.New(err)
+	}
+	if wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return "", errs.ErrTooManyRequests
+	}
+	return code, nil
+}
@@ -4,8 +4,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/go-pandora/core/cache"
 	"github.com/go-pandora/core/models"
+	"log"
 	"net/http"
-	"strconv"
 )
 
 func Register(c *gin.Context) {
@@ -15,7 +15,7 @@ func Register(c *gin.Context) {
 	)
 	defer func() { c.Set("error", err) }()
 
-	if c.BindJSON(&user) != nil {
+	if err = BindJSON(c, &user); err != nil {
 		return
 	}
 
@@ -23,68 +23,23 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	// TODO: send new user an email to activate his account.
-	//token, _ := jsonutil.GenerateAccessJWT(user.Id)
-	//url := "http://pandora.com/auth/activate?token=" + token
-	//log.Println(url)
-	//send email...
-	c.Status(http.StatusOK)
-}
-
-//func ActivateUser(c *gin.Context) {
-//	token := c.Query("token")
-//	id, _, err := jwt.ValidateAccessJWT(token)
-//	if err != nil {
-//		c.Status(http.StatusBadRequest)
-//		return
-//	}
-//	var user models.User
-//	user.Id = id
-//
-//	if err := user.ActivateUser(); err != nil {
-//		c.Set("error", err)
-//		return
-//	}
-//
-//	c.Status(http.StatusOK)
-//}
-
-func RestrictUser(c *gin.Context) {
-	id := c.GetInt64("id")
-	var user models.User
-	user.Id = id
-	if err := user.RestrictUser(); err != nil {
-		c.Set("error", err)
-		return
-	}
-
-	if err := cache.RevokeJWT(strconv.FormatInt(id, 10)); err != nil {
-		c.Set("error", err)
-		return
-	}
-
-	c.Status(http.StatusOK)
-}
-
-func BanUser(c *gin.Context) {
-	id := c.GetInt64("id")
-	var user models.User
-	user.Id = id
-	if err := user.BanUser(); err != nil {
-		c.Set("error", err)
-		return
-	}
-	if err := cache.RevokeJWT(strconv.FormatInt(id, 10)); err != nil {
-		c.Set("error", err)
-		return
+	if user.Email != nil {
+		if e := sendActivationEmail(&user); e != nil {
+			log.Printf("failed to send activation email to user %d: %s", user.Id, e)
+		}
+	} else {
+		// User who registers by cellphone is activated once he logs in by the code.
+		if e := sendOTP(c, cache.OTPLogin, *user.Cellphone); e != nil {
+			log.Printf("failed to send login code to user %d: %s", user.Id, e)
+		}
 	}
-
 	c.Status(http.StatusOK)
 }
 
 func UpdateProfile(c *gin.Context) {
 	var user models.User
-	if c.BindJSON(&user) != nil {
+	if err := BindJSON(c, &user); err != nil {
+		c.Set("error", err)
 		return
 	}
 
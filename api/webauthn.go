@@ -0,0 +1,294 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/core/cache"
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/models"
+	"github.com/go-pandora/core/util/randutil"
+	"github.com/go-pandora/core/util/webauthn"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// publicKeyCredential is PublicKeyCredential serialized by browser, binary fields are base64url encoded.
+type publicKeyCredential struct {
+	Id       string `json:"id"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+type webAuthnRequest struct {
+	CeremonyId string              `json:"ceremony_id"`
+	Name       string              `json:"name"` // name of a new passkey, e.g. "YubiKey"
+	Credential publicKeyCredential `json:"credential"`
+}
+
+type credentialDescriptor struct {
+	Type string `json:"type"`
+	Id   string `json:"id"`
+}
+
+func relyingParty() *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{
+		ID:                      Config.WebAuthnRPID,
+		Name:                    Config.WebAuthnRPName,
+		Origins:                 Config.WebAuthnOrigins,
+		RequireUserVerification: Config.WebAuthnUserVerification,
+	}
+}
+
+func userVerification() string {
+	if Config.WebAuthnUserVerification {
+		return "required"
+	}
+	return "preferred"
+}
+
+// BeginPasskeyRegistration returns options of navigator.credentials.create() for the authenticated user.
+// Passkeys registered before are excluded, so that an authenticator can't be registered twice.
+func BeginPasskeyRegistration(c *gin.Context) {
+	var (
+		user models.User
+		err  error
+	)
+	defer func() { c.Set("error", err) }()
+
+	id := c.GetInt64("id")
+	if err = user.GetAccount(id); err != nil {
+		return
+	}
+	credentials, err := models.GetUserCredentials(id)
+	if err != nil {
+		return
+	}
+	challenge, ceremonyId, err := newCeremony(id)
+	if err != nil {
+		return
+	}
+
+	params := make([]gin.H, len(webauthn.Algorithms))
+	for i, alg := range webauthn.Algorithms {
+		params[i] = gin.H{"type": "public-key", "alg": alg}
+	}
+	c.JSON(http.StatusOK, Response{Data: gin.H{
+		"ceremony_id": ceremonyId,
+		"public_key": gin.H{
+			"rp": gin.H{"id": Config.WebAuthnRPID, "name": Config.WebAuthnRPName},
+			"user": gin.H{
+				"id":          webauthn.EncodeBase64([]byte(strconv.FormatInt(id, 10))),
+				"name":        user.Username,
+				"displayName": user.Username,
+			},
+			"challenge":          challenge,
+			"pubKeyCredParams":   params,
+			"timeout":            Config.WebAuthnTimeout.Nanoseconds() / 1e6,
+			"excludeCredentials": descriptors(credentials),
+			"authenticatorSelection": gin.H{
+				"residentKey":      "preferred",
+				"userVerification": userVerification(),
+			},
+			"attestation": "none",
+		},
+	}})
+}
+
+// FinishPasskeyRegistration verifies the new passkey created by authenticator and stores it.
+func FinishPasskeyRegistration(c *gin.Context) {
+	var (
+		req webAuthnRequest
+		err error
+	)
+	defer func() { c.Set("error", err) }()
+
+	if err = BindJSON(c, &req); err != nil {
+		return
+	}
+	id := c.GetInt64("id")
+	challenge, uid, err := cache.ConsumeWebAuthnChallenge(req.CeremonyId)
+	if err != nil {
+		return
+	}
+	if uid != id {
+		err = errs.ErrInvalidToken
+		return
+	}
+
+	clientData, err1 := webauthn.DecodeBase64(req.Credential.Response.ClientDataJSON)
+	attestation, err2 := webauthn.DecodeBase64(req.Credential.Response.AttestationObject)
+	if err1 != nil || err2 != nil {
+		err = errs.ErrInvalidData
+		return
+	}
+	credential, err := relyingParty().VerifyRegistration(challenge, clientData, attestation)
+	if err != nil {
+		err = passkeyError(err)
+		return
+	}
+
+	passkey := &models.Credential{
+		UserId:       id,
+		CredentialId: webauthn.EncodeBase64(credential.ID),
+		PublicKey:    credential.PublicKey,
+		SignCount:    int64(credential.SignCount),
+		Name:         req.Name,
+	}
+	if err = passkey.AddCredential(); err != nil {
+		return
+	}
+	c.JSON(http.StatusOK, Response{Data: passkey})
+}
+
+// GetPasskeys lists passkeys of the authenticated user.
+func GetPasskeys(c *gin.Context) {
+	credentials, err := models.GetUserCredentials(c.GetInt64("id"))
+	if err != nil {
+		c.Set("error", err)
+		return
+	}
+	c.JSON(http.StatusOK, Response{Data: credentials})
+}
+
+// DeletePasskey removes a passkey of the authenticated user.
+func DeletePasskey(c *gin.Context) {
+	passkey, err := strconv.ParseInt(c.Param("passkey"), 10, 64)
+	if err != nil {
+		c.Set("error", errs.ErrInvalidParam)
+		return
+	}
+	if err = models.DeleteCredential(c.GetInt64("id"), passkey); err != nil {
+		c.Set("error", err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// BeginPasskeyLogin returns options of navigator.credentials.get().
+// If email address or cellphone number is provided, only passkeys of that user are allowed,
+// otherwise authenticator lets user choose a discoverable passkey.
+// An unregistered address gets the same options as a user without passkeys, so that it can't tell who has an account.
+func BeginPasskeyLogin(c *gin.Context) {
+	var (
+		user models.User
+		err  error
+	)
+	defer func() { c.Set("error", err) }()
+
+	// body is optional for a discoverable passkey.
+	if c.Request.ContentLength != 0 {
+		if err = BindJSON(c, &user); err != nil {
+			return
+		}
+	}
+	allowed := make([]credentialDescriptor, 0)
+	if user.Email != nil || user.Cellphone != nil {
+		if err = user.GetUserByContact(); err == errs.ErrUserNotFound {
+			err, user.Id = nil, 0
+		} else if err != nil {
+			return
+		} else {
+			var credentials []models.Credential
+			if credentials, err = models.GetUserCredentials(user.Id); err != nil {
+				return
+			}
+			allowed = descriptors(credentials)
+		}
+	}
+	challenge, ceremonyId, err := newCeremony(user.Id)
+	if err != nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Data: gin.H{
+		"ceremony_id": ceremonyId,
+		"public_key": gin.H{
+			"rpId":             Config.WebAuthnRPID,
+			"challenge":        challenge,
+			"timeout":          Config.WebAuthnTimeout.Nanoseconds() / 1e6,
+			"allowCredentials": allowed,
+			"userVerification": userVerification(),
+		},
+	}})
+}
+
+// LoginByPasskey verifies the assertion of a passkey, and logs in its owner without password.
+// It also tells whether authenticator has verified user, who has passed two factors if so.
+func LoginByPasskey(c *gin.Context) (*models.User, bool, error) {
+	var req webAuthnRequest
+	if err := BindJSON(c, &req); err != nil {
+		return nil, false, err
+	}
+	challenge, uid, err := cache.ConsumeWebAuthnChallenge(req.CeremonyId)
+	if err != nil {
+		return nil, false, err
+	}
+
+	response := req.Credential.Response
+	rawId, err1 := webauthn.DecodeBase64(req.Credential.Id)
+	clientData, err2 := webauthn.DecodeBase64(response.ClientDataJSON)
+	authData, err3 := webauthn.DecodeBase64(response.AuthenticatorData)
+	signature, err4 := webauthn.DecodeBase64(response.Signature)
+	userHandle, err5 := webauthn.DecodeBase64(response.UserHandle)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || err5 != nil {
+		return nil, false, errs.ErrInvalidData
+	}
+
+	var passkey models.Credential
+	if err = passkey.GetCredential(webauthn.EncodeBase64(rawId)); err != nil {
+		return nil, false, err
+	}
+	owner := strconv.FormatInt(passkey.UserId, 10)
+	if (uid != 0 && uid != passkey.UserId) || (len(userHandle) != 0 && string(userHandle) != owner) {
+		return nil, false, errs.ErrInvalidPasskey
+	}
+	assertion, err := relyingParty().VerifyAssertion(challenge, passkey.PublicKey, uint32(passkey.SignCount),
+		clientData, authData, signature)
+	if err != nil {
+		return nil, false, passkeyError(err)
+	}
+	if err = passkey.UseCredential(int64(assertion.SignCount)); err != nil {
+		return nil, false, err
+	}
+
+	user := &models.User{}
+	if err = user.LoginById(passkey.UserId); err != nil {
+		return nil, false, err
+	}
+	return user, assertion.UserVerified, nil
+}
+
+// newCeremony creates a challenge for user, and returns it with id of the ceremony.
+func newCeremony(uid int64) (string, string, error) {
+	random, err := randutil.Bytes(32)
+	if err != nil {
+		return "", "", errs.New(err)
+	}
+	challenge := webauthn.NewChallenge(random)
+	ceremonyId, err := cache.SetWebAuthnChallenge(challenge, uid)
+	if err != nil {
+		return "", "", errs.New(err)
+	}
+	return challenge, ceremonyId, nil
+}
+
+func descriptors(credentials []models.Credential) []credentialDescriptor {
+	list := make([]credentialDescriptor, len(credentials))
+	for i, credential := range credentials {
+		list[i] = credentialDescriptor{Type: "public-key", Id: credential.CredentialId}
+	}
+	return list
+}
+
+// passkeyError hides why a ceremony fails from client, which is only useful in log.
+func passkeyError(err error) error {
+	log.Printf("failed to verify passkey: %s", err)
+	return errs.ErrInvalidPasskey
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-redis/redis"
+	"strconv"
+)
+
+const (
+	PrefixActivation     = "activation:"
+	PrefixActivationUser = "activation_user:"
+)
+
+// SetActivationToken stores an activation token of user.
+// Token issued before will be invalidated, so only the latest activation link works.
+func SetActivationToken(id int64, token string) error {
+	userKey := PrefixActivationUser + strconv.FormatInt(id, 10)
+	if old, err := client.Get(userKey).Result(); err == nil {
+		client.Del(PrefixActivation + old)
+	}
+
+	_, err := client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Set(PrefixActivation+token, id, Config.ActivationTimeout)
+		pipe.Set(userKey, token, Config.ActivationTimeout)
+		return nil
+	})
+	return err
+}
+
+// ConsumeActivationToken returns id of the user who owns the token.
+// A token can only be consumed once.
+func ConsumeActivationToken(token string) (int64, error) {
+	key := PrefixActivation + token
+	var get *redis.StringCmd
+	_, err := client.TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.Get(key)
+		pipe.Del(key)
+		return nil
+	})
+	if err == redis.Nil {
+		return 0, errs.ErrInvalidToken
+	} else if err != nil {
+		return 0, errs.New(err)
+	}
+
+	id, err := get.Int64()
+	if err != nil {
+		return 0, errs.ErrInvalidToken
+	}
+	client.Del(PrefixActivationUser + strconv.FormatInt(id, 10))
+	return id, nil
+}
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-redis/redis"
+	"strconv"
+	"time"
+)
+
+const (
+	PrefixAuthCode     = "auth_code:"
+	PrefixRevokedToken = "revoked_token:"
+)
+
+// AuthorizationCode is what an app gets after user consents, and redeems for tokens.
+type AuthorizationCode struct {
+	ClientId    string
+	UserId      int64
+	RedirectURI string
+	Scope       string
+	Challenge   string // PKCE code challenge by S256
+	// RedirectExplicit tells whether redirect URI was in the authorization request,
+	// only then it is required when the code is redeemed.
+	RedirectExplicit bool
+}
+
+// SetAuthorizationCode stores an authorization code, which has to be redeemed in a short time.
+func SetAuthorizationCode(code string, a *AuthorizationCode) error {
+	_, err := client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet(PrefixAuthCode+code, map[string]interface{}{
+			"client":    a.ClientId,
+			"uid":       a.UserId,
+			"redirect":  a.RedirectURI,
+			"scope":     a.Scope,
+			"challenge": a.Challenge,
+			"explicit":  strconv.FormatBool(a.RedirectExplicit),
+		})
+		pipe.Expire(PrefixAuthCode+code, Config.AuthCodeTimeout)
+		return nil
+	})
+	return err
+}
+
+// ConsumeAuthorizationCode returns an authorization code, which can only be redeemed once.
+func ConsumeAuthorizationCode(code string) (*AuthorizationCode, error) {
+	key := PrefixAuthCode + code
+	var get *redis.StringStringMapCmd
+	if _, err := client.TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.HGetAll(key)
+		pipe.Del(key)
+		return nil
+	}); err != nil {
+		return nil, errs.New(err)
+	}
+
+	values := get.Val()
+	uid, err := strconv.ParseInt(values["uid"], 10, 64)
+	if err != nil || values["client"] == "" {
+		return nil, errs.ErrInvalidToken
+	}
+	explicit, _ := strconv.ParseBool(values["explicit"])
+	return &AuthorizationCode{
+		ClientId:         values["client"],
+		UserId:           uid,
+		RedirectURI:      values["redirect"],
+		Scope:            values["scope"],
+		Challenge:        values["challenge"],
+		RedirectExplicit: explicit,
+	}, nil
+}
+
+// ClientJWTKey identifies jwt issued to an app on behalf of user, which can be revoked together by RevokeJWT.
+// Zero uid identifies all jwt issued to the app.
+func ClientJWTKey(clientId string, uid int64) string {
+	if uid == 0 {
+		return "client:" + clientId
+	}
+	return "client:" + clientId + ":" + strconv.FormatInt(uid, 10)
+}
+
+// RevokeToken revokes a single jwt by its id until it expires.
+func RevokeToken(jti string, expireAt time.Time) error {
+	ttl := time.Until(expireAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return client.Set(PrefixRevokedToken+jti, 1, ttl).Err()
+}
+
+// ConsumeToken revokes a single jwt which can only be used once, and tells whether it is consumed by this call.
+// Only one of concurrent requests is able to consume a token.
+func ConsumeToken(jti string, expireAt time.Time) (bool, error) {
+	ttl := time.Until(expireAt)
+	if ttl <= 0 {
+		return false, nil
+	}
+	return client.SetNX(PrefixRevokedToken+jti, 1, ttl).Result()
+}
+
+// IsTokenRevoked checks if a single jwt has been revoked.
+func IsTokenRevoked(jti string) bool {
+	n, err := client.Exists(PrefixRevokedToken + jti).Result()
+	return err == nil && n > 0
+}
@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"crypto/subtle"
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-redis/redis"
+)
+
+const PrefixCaptcha = "captcha:"
+
+// SetCaptcha stores answer of captcha id, only its hash is stored.
+func SetCaptcha(id string, answer string) error {
+	return client.Set(PrefixCaptcha+id, hashCode(answer), Config.CaptchaTimeout).Err()
+}
+
+// VerifyCaptcha checks answer of captcha id.
+// A captcha can only be tried once, no matter whether the answer is correct.
+func VerifyCaptcha(id string, answer string) error {
+	key := PrefixCaptcha + id
+	var get *redis.StringCmd
+	_, err := client.TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.Get(key)
+		pipe.Del(key)
+		return nil
+	})
+	if err == redis.Nil {
+		return errs.ErrInvalidCaptcha
+	} else if err != nil {
+		return errs.New(err)
+	}
+	if subtle.ConstantTimeCompare([]byte(get.Val()), []byte(hashCode(answer))) != 1 {
+		return errs.ErrInvalidCaptcha
+	}
+	return nil
+}
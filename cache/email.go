@@ -0,0 +1,52 @@
+package cache
+
+import (
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-redis/redis"
+	"strconv"
+)
+
+const (
+	PrefixEmailChange     = "email_change:"
+	PrefixEmailChangeUser = "email_change_user:"
+)
+
+// SetEmailChange stores a pending change of user's email address, which is confirmed by token.
+// Only the latest change of a user is pending, and the ones requested before are dropped.
+func SetEmailChange(id int64, email string, token string) error {
+	userKey := PrefixEmailChangeUser + strconv.FormatInt(id, 10)
+	if old, err := client.Get(userKey).Result(); err == nil {
+		client.Del(PrefixEmailChange + old)
+	}
+
+	_, err := client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet(PrefixEmailChange+token, map[string]interface{}{"uid": id, "email": email})
+		pipe.Expire(PrefixEmailChange+token, Config.EmailChangeTimeout)
+		pipe.Set(userKey, token, Config.EmailChangeTimeout)
+		return nil
+	})
+	return err
+}
+
+// ConsumeEmailChange returns id of the user and the new email address confirmed by token.
+// A token can only be consumed once.
+func ConsumeEmailChange(token string) (int64, string, error) {
+	key := PrefixEmailChange + token
+	var get *redis.StringStringMapCmd
+	if _, err := client.TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.HGetAll(key)
+		pipe.Del(key)
+		return nil
+	}); err != nil {
+		return 0, "", errs.New(err)
+	}
+
+	change := get.Val()
+	id, err := strconv.ParseInt(change["uid"], 10, 64)
+	if err != nil || change["email"] == "" {
+		return 0, "", errs.ErrInvalidToken
+	}
+	client.Del(PrefixEmailChangeUser + change["uid"])
+	return id, change["email"], nil
+}
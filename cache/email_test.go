@@ -0,0 +1,30 @@
+package cache
+
+import (
+	"github.com/go-pandora/core/errs"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEmailChange(t *testing.T) {
+	requireRedis(t)
+	assert := assert.New(t)
+	var id int64 = -1
+	defer client.Del(PrefixEmailChangeUser+"-1", PrefixEmailChange+"first-token", PrefixEmailChange+"second-token")
+
+	assert.Nil(SetEmailChange(id, "first@example.com", "first-token"))
+	// only the latest change is pending.
+	assert.Nil(SetEmailChange(id, "second@example.com", "second-token"))
+	_, _, err := ConsumeEmailChange("first-token")
+	assert.Equal(errs.ErrInvalidToken, err)
+
+	uid, email, err := ConsumeEmailChange("second-token")
+	assert.Nil(err)
+	assert.Equal(id, uid)
+	assert.Equal("second@example.com", email)
+
+	// a token can only be consumed once.
+	_, _, err = ConsumeEmailChange("second-token")
+	assert.Equal(errs.ErrInvalidToken, err)
+	assert.Zero(client.Exists(PrefixEmailChangeUser + "-1").Val())
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-redis/redis"
+	"strconv"
+	"time"
+)
+
+const (
+	PrefixLoginFailures = "login_failures:"
+	PrefixLoginLock     = "login_lock:"
+)
+
+// LoginAccountKey is the throttling key of an account, which is named by what user logs in with.
+func LoginAccountKey(account string) string {
+	return "account:" + account
+}
+
+// LoginUserKey is the throttling key of a known user, whatever user logs in with.
+func LoginUserKey(id int64) string {
+	return "user:" + strconv.FormatInt(id, 10)
+}
+
+// LoginIPKey is the throttling key of an IP.
+func LoginIPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// LoginLocked returns how long key is still locked, zero means it is not locked.
+func LoginLocked(key string) (time.Duration, error) {
+	ttl, err := client.PTTL(PrefixLoginLock + key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// LoginFailures returns how many times key has failed to login recently.
+func LoginFailures(key string) (int, error) {
+	failures, err := client.Get(PrefixLoginFailures + key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return int(failures), err
+}
+
+// RecordLoginFailure counts a failed login of key, and locks key once failures reach threshold.
+// The lock doubles on each further failure, and returned duration is how long key is locked.
+func RecordLoginFailure(key string, threshold int) (time.Duration, error) {
+	var incr *redis.IntCmd
+	if _, err := client.TxPipelined(func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(PrefixLoginFailures + key)
+		pipe.Expire(PrefixLoginFailures+key, Config.FailureWindow)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	failures := int(incr.Val())
+	if failures < threshold {
+		return 0, nil
+	}
+	lock := Config.LockDuration
+	for i := threshold; i < failures && lock < Config.MaxLockDuration; i++ {
+		lock *= 2
+	}
+	if lock > Config.MaxLockDuration {
+		lock = Config.MaxLockDuration
+	}
+	if err := client.Set(PrefixLoginLock+key, failures, lock).Err(); err != nil {
+		return 0, err
+	}
+	return lock, nil
+}
+
+// ClearLoginFailures forgets failures of keys and lifts their locks.
+func ClearLoginFailures(keys ...string) error {
+	var all []string
+	for _, key := range keys {
+		all = append(all, PrefixLoginFailures+key, PrefixLoginLock+key)
+	}
+	return client.Del(all...).Err()
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/util/randutil"
+	"github.com/go-redis/redis"
+	"strconv"
+)
+
+const (
+	PrefixMFAPending = "mfa_pending:"
+
+	// MaxMFAAttempts is how many wrong codes can be tried before a pending login is discarded.
+	MaxMFAAttempts = 5
+)
+
+// CreateMFAPending stores a login of user which has passed the first factor,
+// and returns a token to complete it by the second factor.
+func CreateMFAPending(uid int64) (string, error) {
+	token, err := randutil.Token(32)
+	if err != nil {
+		return "", err
+	}
+	if err = client.HMSet(PrefixMFAPending+token, map[string]interface{}{"uid": uid, "attempts": 0}).Err(); err != nil {
+		return "", err
+	}
+	if err = client.Expire(PrefixMFAPending+token, Config.MFAPendingTimeout).Err(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// GetMFAPending returns id of the user whose login is pending on token.
+func GetMFAPending(token string) (int64, error) {
+	value, err := client.HGet(PrefixMFAPending+token, "uid").Result()
+	if err == redis.Nil {
+		return 0, errs.ErrInvalidToken
+	} else if err != nil {
+		return 0, errs.New(err)
+	}
+	uid, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, errs.ErrInvalidToken
+	}
+	return uid, nil
+}
+
+// Attempts are only counted on a pending login which still exists, otherwise the key would never expire.
+var mfaFailureScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+local attempts = redis.call("HINCRBY", KEYS[1], "attempts", 1)
+if attempts >= tonumber(ARGV[1]) then
+	redis.call("DEL", KEYS[1])
+end
+return attempts
+`)
+
+// RecordMFAFailure counts a wrong code tried on token, and discards token after MaxMFAAttempts,
+// so that user has to pass the first factor again.
+func RecordMFAFailure(token string) error {
+	return mfaFailureScript.Run(client, []string{PrefixMFAPending + token}, MaxMFAAttempts).Err()
+}
+
+// ConsumeMFAPending discards token once its login is completed.
+// Only one of concurrent requests is able to consume a token.
+func ConsumeMFAPending(token string) error {
+	deleted, err := client.Del(PrefixMFAPending + token).Result()
+	if err != nil {
+		return errs.New(err)
+	}
+	if deleted == 0 {
+		return errs.ErrInvalidToken
+	}
+	return nil
+}
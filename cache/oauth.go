@@ -0,0 +1,53 @@
+package cache
+
+import (
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-redis/redis"
+	"strconv"
+)
+
+const PrefixOAuthState = "oauth_state:"
+
+// OAuthState is what server remembers between redirecting user to provider and getting the code back.
+type OAuthState struct {
+	Provider string
+	Verifier string // PKCE code verifier
+	Nonce    string
+	UserId   int64 // user who links an external account, zero means logging in
+}
+
+// SetOAuthState stores state of an authorization request.
+func SetOAuthState(state string, s *OAuthState) error {
+	_, err := client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet(PrefixOAuthState+state, map[string]interface{}{
+			"provider": s.Provider,
+			"verifier": s.Verifier,
+			"nonce":    s.Nonce,
+			"uid":      s.UserId,
+		})
+		pipe.Expire(PrefixOAuthState+state, Config.OAuthStateTimeout)
+		return nil
+	})
+	return err
+}
+
+// ConsumeOAuthState returns state of an authorization request, which can only be consumed once.
+func ConsumeOAuthState(state string) (*OAuthState, error) {
+	key := PrefixOAuthState + state
+	var get *redis.StringStringMapCmd
+	if _, err := client.TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.HGetAll(key)
+		pipe.Del(key)
+		return nil
+	}); err != nil {
+		return nil, errs.New(err)
+	}
+
+	values := get.Val()
+	uid, err := strconv.ParseInt(values["uid"], 10, 64)
+	if err != nil || values["provider"] == "" {
+		return nil, errs.ErrInvalidToken
+	}
+	return &OAuthState{Provider: values["provider"], Verifier: values["verifier"], Nonce: values["nonce"], UserId: uid}, nil
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	. "github.com/go-pandora/core/conf"
+	"time"
+)
+
+const (
+	PrefixOTP         = "otp:"
+	PrefixOTPAttempts = "otp_attempts:"
+	PrefixOTPInterval = "otp_interval:"
+	PrefixOTPCount    = "otp_count:"
+
+	// MaxOTPAttempts is how many wrong codes can be tried before a one-time code is discarded.
+	MaxOTPAttempts = 5
+)
+
+// Purposes of one-time codes, a code can only be used for what it is sent for.
+const (
+	OTPLogin  = "login"
+	OTPVerify = "verify"
+)
+
+// SetOTP stores a one-time code sent to target for purpose, and the code sent before is replaced.
+// Codes can't be sent to a target too often, if so, the code is not stored and
+// the returned duration tells how long to wait before sending another one.
+func SetOTP(purpose string, target string, code string) (time.Duration, error) {
+	wait, err := throttleSend(target)
+	if err != nil || wait > 0 {
+		return wait, err
+	}
+	key := purpose + ":" + target
+	return 0, setCode(PrefixOTP+key, code, Config.OTPTimeout)
+}
+
+// throttleSend limits codes sent to target by OTPInterval and OTPHourlyLimit,
+// and returns how long to wait if a code can't be sent now.
+func throttleSend(target string) (time.Duration, error) {
+	ok, err := client.SetNX(PrefixOTPInterval+target, 1, Config.OTPInterval).Result()
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return waitFor(PrefixOTPInterval + target)
+	}
+
+	count, err := client.Incr(PrefixOTPCount + target).Result()
+	if err != nil {
+		return 0, err
+	}
+	if count == 1 {
+		client.Expire(PrefixOTPCount+target, time.Hour)
+	}
+	if count > int64(Config.OTPHourlyLimit) {
+		return waitFor(PrefixOTPCount + target)
+	}
+	return 0, nil
+}
+
+func waitFor(key string) (time.Duration, error) {
+	ttl, err := client.PTTL(key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl <= 0 {
+		ttl = time.Second
+	}
+	return ttl, nil
+}
+
+// ConsumeOTP checks whether code is the latest one sent to target for purpose.
+// A valid code can only be consumed once, and too many wrong attempts discard the code.
+func ConsumeOTP(purpose string, target string, code string) error {
+	key := purpose + ":" + target
+	return consumeCode(PrefixOTP+key, PrefixOTPAttempts+key, code, Config.OTPTimeout, MaxOTPAttempts)
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestResetCode(t *testing.T) {
+	requireRedis(t)
+	assert := assert.New(t)
+	var id int64 = -1
+	clean := func() {
+		client.Del(PrefixReset+"-1", PrefixResetAttempts+"-1",
+			PrefixOTPInterval+PrefixReset+"-1", PrefixOTPCount+PrefixReset+"-1")
+	}
+	clean()
+	defer clean()
+	set := func(code string) {
+		client.Del(PrefixOTPInterval+PrefixReset+"-1", PrefixOTPCount+PrefixReset+"-1")
+		wait, err := SetResetCode(id, code)
+		assert.Nil(err)
+		assert.Zero(wait)
+	}
+
+	assert.Equal(errs.ErrInvalidCode, ConsumeResetCode(id, "123456"))
+
+	// a valid code can only be consumed once.
+	set("123456")
+	assert.Nil(ConsumeResetCode(id, "123456"))
+	assert.Equal(errs.ErrInvalidCode, ConsumeResetCode(id, "123456"))
+
+	// another code can't be issued within the interval.
+	wait, err := SetResetCode(id, "654321")
+	assert.Nil(err)
+	assert.True(wait > 0 && wait <= Config.OTPInterval)
+	assert.Equal(errs.ErrInvalidCode, ConsumeResetCode(id, "654321"))
+
+	// a new code replaces the old one, and wrong attempts of the old one still count.
+	set("111111")
+	for i := 0; i < MaxResetAttempts-1; i++ {
+		assert.Equal(errs.ErrInvalidCode, ConsumeResetCode(id, "000000"))
+	}
+	set("222222")
+	assert.Equal(errs.ErrInvalidCode, ConsumeResetCode(id, "111111"))
+	// too many wrong attempts discard the code, and codes issued later are refused as well.
+	assert.Equal(errs.ErrInvalidCode, ConsumeResetCode(id, "222222"))
+	set("333333")
+	assert.Equal(errs.ErrInvalidCode, ConsumeResetCode(id, "333333"))
+
+	// a valid code clears wrong attempts.
+	client.Del(PrefixResetAttempts + "-1")
+	set("444444")
+	assert.Equal(errs.ErrInvalidCode, ConsumeResetCode(id, "000000"))
+	assert.Nil(ConsumeResetCode(id, "444444"))
+	assert.Zero(client.Exists(PrefixResetAttempts + "-1").Val())
+}
+
+func TestOTP(t *testing.T) {
+	requireRedis(t)
+	assert := assert.New(t)
+	target := "test-otp-target"
+	clean := func() {
+		client.Del(PrefixOTPInterval+target, PrefixOTPCount+target,
+			PrefixOTP+OTPLogin+":"+target, PrefixOTPAttempts+OTPLogin+":"+target,
+			PrefixOTP+OTPVerify+":"+target, PrefixOTPAttempts+OTPVerify+":"+target)
+	}
+	clean()
+	defer clean()
+
+	wait, err := SetOTP(OTPLogin, target, "123456")
+	assert.Nil(err)
+	assert.Zero(wait)
+
+	// a code is only valid for its purpose.
+	assert.Equal(errs.ErrInvalidCode, ConsumeOTP(OTPVerify, target, "123456"))
+	assert.Nil(ConsumeOTP(OTPLogin, target, "123456"))
+	assert.Equal(errs.ErrInvalidCode, ConsumeOTP(OTPLogin, target, "123456"))
+
+	// another code can't be sent within the interval.
+	wait, err = SetOTP(OTPLogin, target, "654321")
+	assert.Nil(err)
+	assert.True(wait > 0 && wait <= Config.OTPInterval)
+	assert.Equal(errs.ErrInvalidCode, ConsumeOTP(OTPLogin, target, "654321"))
+
+	// no more codes are sent than the hourly limit.
+	for i := 1; i < Config.OTPHourlyLimit; i++ {
+		client.Del(PrefixOTPInterval + target)
+		wait, err = SetOTP(OTPVerify, target, "111111")
+		assert.Nil(err)
+		assert.Zero(wait)
+	}
+	client.Del(PrefixOTPInterval + target)
+	wait, err = SetOTP(OTPVerify, target, "222222")
+	assert.Nil(err)
+	assert.True(wait > 0)
+	assert.Nil(ConsumeOTP(OTPVerify, target, "111111"))
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-redis/redis"
+	"strconv"
+	"time"
+)
+
+const (
+	PrefixReset         = "reset:"
+	PrefixResetAttempts = "reset_attempts:"
+
+	// MaxResetAttempts is how many wrong codes a user can try before the reset code is discarded.
+	MaxResetAttempts = 5
+)
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// SetResetCode stores a password reset code of user.
+// Only hash of the code is stored, and the code issued before will be replaced.
+// Codes are limited like one-time codes, if a code has been issued recently,
+// it is not stored and the returned duration tells how long to wait.
+func SetResetCode(id int64, code string) (time.Duration, error) {
+	uid := strconv.FormatInt(id, 10)
+	wait, err := throttleSend(PrefixReset + uid)
+	if err != nil || wait > 0 {
+		return wait, err
+	}
+	return 0, setCode(PrefixReset+uid, code, Config.ResetTimeout)
+}
+
+// ConsumeResetCode checks whether code is the latest reset code of user.
+// A valid code can only be consumed once, and too many wrong attempts discard the code.
+func ConsumeResetCode(id int64, code string) error {
+	uid := strconv.FormatInt(id, 10)
+	return consumeCode(PrefixReset+uid, PrefixResetAttempts+uid, code, Config.ResetTimeout, MaxResetAttempts)
+}
+
+// setCode stores hash of code at key.
+// Wrong attempts are kept, so that issuing another code doesn't allow more guesses.
+func setCode(key string, code string, expiration time.Duration) error {
+	return client.Set(key, hashCode(code), expiration).Err()
+}
+
+// consumeCode checks code against the hash at key.
+// A valid code can only be consumed once. Every attempt is counted at attemptsKey, which lives as long as
+// a code after the last attempt, and no code is accepted after maxAttempts wrong attempts until it expires.
+func consumeCode(key string, attemptsKey string, code string, expiration time.Duration, maxAttempts int64) error {
+	hash, err := client.Get(key).Result()
+	if err == redis.Nil {
+		return errs.ErrInvalidCode
+	} else if err != nil {
+		return errs.New(err)
+	}
+
+	// Attempts are counted before checking, so that concurrent guesses can't exceed the limit.
+	attempts, err := client.Incr(attemptsKey).Result()
+	if err != nil {
+		return errs.New(err)
+	}
+	client.Expire(attemptsKey, expiration)
+	if attempts > maxAttempts ||
+		subtle.ConstantTimeCompare([]byte(hash), []byte(hashCode(code))) != 1 {
+		if attempts >= maxAttempts {
+			client.Del(key)
+		}
+		return errs.ErrInvalidCode
+	}
+
+	// Only one of concurrent requests is able to delete the code.
+	deleted, err := client.Del(key).Result()
+	if err != nil {
+		return errs.New(err)
+	}
+	if deleted == 0 {
+		return errs.ErrInvalidCode
+	}
+	client.Del(attemptsKey)
+	return nil
+}
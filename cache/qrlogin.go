@@ -0,0 +1,98 @@
+package cache
+
+import (
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-redis/redis"
+	"strconv"
+)
+
+const PrefixQRLogin = "qr_login:"
+
+// Status of a QR login ticket, which goes from pending to scanned to confirmed.
+const (
+	QRPending   = "pending"
+	QRScanned   = "scanned"
+	QRConfirmed = "confirmed"
+)
+
+// CreateQRTicket stores a pending QR login ticket.
+// Only the client who knows secret can get tokens once the ticket is confirmed,
+// so that anyone else who sees the QR code can't.
+func CreateQRTicket(ticket string, secret string) error {
+	_, err := client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet(PrefixQRLogin+ticket, map[string]interface{}{
+			"status": QRPending,
+			"secret": hashCode(secret),
+		})
+		pipe.Expire(PrefixQRLogin+ticket, Config.QRTicketTimeout)
+		return nil
+	})
+	return err
+}
+
+// A ticket can only move forward from one status to the next one,
+// and it must be scanned and confirmed by the same user.
+var qrTransitionScript = redis.NewScript(`
+local state = redis.call("HMGET", KEYS[1], "status", "uid")
+if not state[1] then
+	return -1
+end
+if state[1] ~= ARGV[1] or (state[2] and state[2] ~= ARGV[3]) then
+	return 0
+end
+redis.call("HMSET", KEYS[1], "status", ARGV[2], "uid", ARGV[3])
+return 1
+`)
+
+func transitQRTicket(ticket string, from string, to string, uid int64) error {
+	result, err := qrTransitionScript.Run(client, []string{PrefixQRLogin + ticket},
+		from, to, strconv.FormatInt(uid, 10)).Int64()
+	if err != nil {
+		return errs.New(err)
+	}
+	switch result {
+	case -1:
+		return errs.ErrQRCodeExpired
+	case 0:
+		return errs.ErrQRCodeUsed
+	default:
+		return nil
+	}
+}
+
+// ScanQRTicket marks ticket as scanned by user, so that web client can tell user to confirm on mobile.
+func ScanQRTicket(ticket string, uid int64) error {
+	return transitQRTicket(ticket, QRPending, QRScanned, uid)
+}
+
+// ConfirmQRTicket marks ticket as confirmed by user who has scanned it.
+func ConfirmQRTicket(ticket string, uid int64) error {
+	return transitQRTicket(ticket, QRScanned, QRConfirmed, uid)
+}
+
+// A confirmed ticket is deleted once it is read, so that tokens are issued only once.
+var qrConsumeScript = redis.NewScript(`
+local state = redis.call("HMGET", KEYS[1], "status", "uid", "secret")
+if not state[1] or state[3] ~= ARGV[1] then
+	return false
+end
+if state[1] == "confirmed" then
+	redis.call("DEL", KEYS[1])
+end
+return {state[1], state[2] or ""}
+`)
+
+// ConsumeQRTicket returns status of ticket, and id of the user who confirms it.
+// Once a confirmed ticket is consumed, it no longer exists.
+func ConsumeQRTicket(ticket string, secret string) (string, int64, error) {
+	result, err := qrConsumeScript.Run(client, []string{PrefixQRLogin + ticket}, hashCode(secret)).Result()
+	if err == redis.Nil {
+		return "", 0, errs.ErrQRCodeExpired
+	} else if err != nil {
+		return "", 0, errs.New(err)
+	}
+	state := result.([]interface{})
+	uid, _ := strconv.ParseInt(state[1].(string), 10, 64)
+	return state[0].(string), uid, nil
+}
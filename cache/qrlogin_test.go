@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"github.com/go-pandora/core/errs"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestQRTicket_Flow(t *testing.T) {
+	requireRedis(t)
+	assert := assert.New(t)
+	ticket, secret := "test-qr-ticket", "test-qr-secret"
+	defer client.Del(PrefixQRLogin + ticket)
+	if err := CreateQRTicket(ticket, secret); err != nil {
+		t.Fatal(err)
+	}
+
+	status, _, err := ConsumeQRTicket(ticket, secret)
+	assert.Nil(err)
+	assert.Equal(QRPending, status)
+	_, _, err = ConsumeQRTicket(ticket, "wrong secret")
+	assert.Equal(errs.ErrQRCodeExpired, err)
+
+	// a ticket must be scanned before it is confirmed, and only by the same user.
+	assert.Equal(errs.ErrQRCodeUsed, ConfirmQRTicket(ticket, 1))
+	assert.Nil(ScanQRTicket(ticket, 1))
+	assert.Equal(errs.ErrQRCodeUsed, ScanQRTicket(ticket, 2))
+	status, _, _ = ConsumeQRTicket(ticket, secret)
+	assert.Equal(QRScanned, status)
+	assert.Equal(errs.ErrQRCodeUsed, ConfirmQRTicket(ticket, 2))
+	assert.Nil(ConfirmQRTicket(ticket, 1))
+
+	// a confirmed ticket is consumed only once.
+	status, uid, err := ConsumeQRTicket(ticket, secret)
+	assert.Nil(err)
+	assert.Equal(QRConfirmed, status)
+	assert.Equal(int64(1), uid)
+	_, _, err = ConsumeQRTicket(ticket, secret)
+	assert.Equal(errs.ErrQRCodeExpired, err)
+	assert.Equal(errs.ErrQRCodeExpired, ScanQRTicket(ticket, 1))
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"github.com/go-pandora/core/util/randutil"
+	"github.com/go-redis/redis"
+	"math"
+	"strconv"
+	"time"
+)
+
+const PrefixRateLimit = "ratelimit:"
+
+// RateLimitResult tells whether a request is allowed by a rate limit.
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration // how long until the limit is fully restored
+	RetryAfter time.Duration // how long until next request is allowed, only set if request is denied
+}
+
+// TokenBucket computes the result of a token bucket which holds limit tokens and is refilled in window.
+// tokens is what remains after the request.
+func TokenBucket(allowed bool, tokens float64, limit int, window time.Duration) RateLimitResult {
+	perToken := float64(window) / float64(limit)
+	result := RateLimitResult{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(limit) - tokens) * perToken),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) * perToken)
+	}
+	return result
+}
+
+// SlidingWindow computes the result of a sliding window which allows limit requests in window.
+// oldest and newest are times of requests in current window.
+func SlidingWindow(allowed bool, count int, oldest, newest time.Time, limit int, window time.Duration, now time.Time) RateLimitResult {
+	result := RateLimitResult{Allowed: allowed, Remaining: limit - count}
+	if count > 0 {
+		result.Reset = newest.Add(window).Sub(now)
+	}
+	if !allowed {
+		result.RetryAfter = oldest.Add(window).Sub(now)
+	}
+	return result
+}
+
+var tokenBucketScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1]) or limit
+local ts = tonumber(state[2]) or now
+tokens = math.min(limit, tokens + math.max(0, now - ts) * limit / window)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], window)
+return {allowed, tostring(tokens)}
+`)
+
+// TakeTokenBucket takes a token from the bucket of key.
+func TakeTokenBucket(key string, limit int, window time.Duration) (RateLimitResult, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	values, err := tokenBucketScript.Run(client, []string{PrefixRateLimit + key},
+		limit, int64(window/time.Millisecond), now).Result()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	result := values.([]interface{})
+	tokens, err := strconv.ParseFloat(result[1].(string), 64)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return TokenBucket(result[0].(int64) == 1, tokens, limit, window), nil
+}
+
+// Requests in window are kept in a sorted set scored by time in milliseconds.
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local count = redis.call("ZCARD", KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call("ZADD", KEYS[1], now, ARGV[4])
+	count = count + 1
+	allowed = 1
+end
+redis.call("PEXPIRE", KEYS[1], window)
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+local newest = redis.call("ZRANGE", KEYS[1], -1, -1, "WITHSCORES")
+return {allowed, count, oldest[2] or tostring(now), newest[2] or tostring(now)}
+`)
+
+// TakeSlidingWindow records a request of key if it is allowed in the sliding window.
+func TakeSlidingWindow(key string, limit int, window time.Duration) (RateLimitResult, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	// Concurrent requests may come at the same millisecond, so each one needs a unique member.
+	member, err := randutil.Token(8)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	values, err := slidingWindowScript.Run(client, []string{PrefixRateLimit + key},
+		limit, int64(window/time.Millisecond), now, member).Result()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	result := values.([]interface{})
+	oldest, _ := strconv.ParseFloat(result[2].(string), 64)
+	newest, _ := strconv.ParseFloat(result[3].(string), 64)
+	return SlidingWindow(result[0].(int64) == 1, int(result[1].(int64)), msTime(int64(oldest)), msTime(int64(newest)),
+		limit, window, msTime(now)), nil
+}
+
+func msTime(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
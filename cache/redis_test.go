@@ -0,0 +1,10 @@
+package cache
+
+import "testing"
+
+// requireRedis skips a test if Redis is not available, e.g. when running without configuration.
+func requireRedis(t *testing.T) {
+	if err := Ping(); err != nil {
+		t.Skip("Redis is not available: " + err.Error())
+	}
+}
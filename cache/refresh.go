@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"github.com/go-pandora/core/errs"
+	"github.com/go-redis/redis"
+	"time"
+)
+
+const PrefixRefreshFamily = "refresh_family:"
+
+// Result of rotating a refresh token in its family.
+const (
+	RefreshRotated = 1
+	RefreshRevoked = 0  // family has expired or been revoked
+	RefreshReused  = -1 // token had been used, family is revoked now
+)
+
+// StartRefreshFamily tracks a family of refresh tokens, which begins with the token jti issued at login.
+// Family lives as long as its tokens.
+func StartRefreshFamily(family string, jti string, ttl time.Duration) error {
+	return client.Set(PrefixRefreshFamily+family, jti, ttl).Err()
+}
+
+// Only the latest token of a family can be used, it is replaced by the next one.
+// Once a used token is presented again, either the user or someone who stole it is replaying it,
+// so that the whole family is revoked.
+var refreshRotationScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if not current then
+	return 0
+end
+if current ~= ARGV[1] then
+	redis.call("DEL", KEYS[1])
+	return -1
+end
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl > 0 then
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ttl)
+else
+	redis.call("SET", KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// RotateRefreshFamily replaces token jti of family by next, which expires along with the family.
+func RotateRefreshFamily(family string, jti string, next string) (int64, error) {
+	result, err := refreshRotationScript.Run(client, []string{PrefixRefreshFamily + family}, jti, next).Int64()
+	if err != nil {
+		return 0, errs.New(err)
+	}
+	return result, nil
+}
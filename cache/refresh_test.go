@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRotateRefreshFamily(t *testing.T) {
+	requireRedis(t)
+	assert := assert.New(t)
+	family := "test-family"
+	defer client.Del(PrefixRefreshFamily + family)
+
+	assert.Nil(StartRefreshFamily(family, "first", time.Minute))
+	result, err := RotateRefreshFamily(family, "first", "second")
+	assert.Nil(err)
+	assert.Equal(int64(RefreshRotated), result)
+	assert.Equal("second", client.Get(PrefixRefreshFamily+family).Val())
+	// the next token expires along with the family.
+	ttl := client.TTL(PrefixRefreshFamily + family).Val()
+	assert.True(ttl > 0 && ttl <= time.Minute, ttl.String())
+
+	// reusing a rotated token revokes the whole family.
+	result, err = RotateRefreshFamily(family, "first", "third")
+	assert.Nil(err)
+	assert.Equal(int64(RefreshReused), result)
+	assert.Zero(client.Exists(PrefixRefreshFamily + family).Val())
+
+	// even the latest token doesn't work any more.
+	result, err = RotateRefreshFamily(family, "second", "third")
+	assert.Nil(err)
+	assert.Equal(int64(RefreshRevoked), result)
+	assert.Zero(client.Exists(PrefixRefreshFamily + family).Val())
+}
+
+func TestRotateRefreshFamily_Expired(t *testing.T) {
+	requireRedis(t)
+	assert := assert.New(t)
+	family := "test-expired-family"
+	defer client.Del(PrefixRefreshFamily + family)
+
+	assert.Nil(StartRefreshFamily(family, "first", 10*time.Millisecond))
+	time.Sleep(50 * time.Millisecond)
+	result, err := RotateRefreshFamily(family, "first", "second")
+	assert.Nil(err)
+	assert.Equal(int64(RefreshRevoked), result)
+	assert.Zero(client.Exists(PrefixRefreshFamily + family).Val())
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/util/randutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const PrefixSession = "session:"
+
+// CreateSession creates a session for user and returns an opaque session id.
+// Roles of user are kept in the session.
+func CreateSession(uid string, roles []string) (string, error) {
+	sid, err := randutil.Token(32)
+	if err != nil {
+		return "", err
+	}
+	key := PrefixSession + sid
+	if err = client.HMSet(key, map[string]interface{}{
+		"uid":     uid,
+		"roles":   strings.Join(roles, ","),
+		"created": time.Now().UnixMilli(),
+	}).Err(); err != nil {
+		return "", err
+	}
+	if err = client.Expire(key, Config.SessionTimeout).Err(); err != nil {
+		return "", err
+	}
+	return sid, nil
+}
+
+// GetSession returns the user who owns the session and his roles.
+// Expiration of a valid session slides, but never goes beyond its max lifetime.
+// Sessions created before user's jwt deadline are regarded as revoked.
+func GetSession(sid string) (uid string, roles []string, ok bool) {
+	key := PrefixSession + sid
+	values, err := client.HGetAll(key).Result()
+	if err != nil || values["uid"] == "" {
+		return "", nil, false
+	}
+	uid = values["uid"]
+	created, _ := strconv.ParseInt(values["created"], 10, 64)
+	created = toMilli(created)
+
+	remaining := time.Until(time.UnixMilli(created).Add(Config.MaxLifetime))
+	if _, revoked := IsJWTRevoked(uid, created); revoked || remaining <= 0 {
+		client.Del(key)
+		return "", nil, false
+	}
+
+	timeout := Config.SessionTimeout
+	if remaining < timeout {
+		timeout = remaining
+	}
+	client.Expire(key, timeout)
+	if values["roles"] != "" {
+		roles = strings.Split(values["roles"], ",")
+	}
+	return uid, roles, true
+}
+
+// DeleteSession deletes a session.
+func DeleteSession(sid string) error {
+	return client.Del(PrefixSession + sid).Err()
+}
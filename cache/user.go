@@ -2,7 +2,6 @@ package cache
 
 import (
 	. "github.com/go-pandora/core/conf"
-	"log"
 	"strconv"
 	"strings"
 	"time"
@@ -15,7 +14,7 @@ const (
 )
 
 func addPrefix(key string) string {
-	return strings.Join([]string{PrefixJWT}, key)
+	return strings.Join([]string{PrefixJWT, key}, ":")
 }
 
 // You can use bitmap of cache to keep a record of each user's login status.
@@ -29,23 +28,42 @@ func SetStatusLogout(id int64) error {
 }
 
 // RevokeJWT sets a deadline of user's jwt.
-// All jwt issued before the new deadline will be revoked.
+// All jwt and sessions issued before the new deadline will be revoked.
+// The deadline lives as long as a refresh token or a session, so that none of them can outlive it.
 func RevokeJWT(id string) error {
 	key := addPrefix(id)
-	return client.Set(key, time.Now().Unix(), Config.Timeout).Err()
+	expiration := Config.MaxRefreshTime
+	if Config.MaxLifetime > expiration {
+		expiration = Config.MaxLifetime
+	}
+	return client.Set(key, time.Now().UnixMilli(), expiration).Err()
 }
 
-// IsJWTRevoked checks if user's jwt is revoked.
+// IsJWTRevoked checks if user's jwt issued at timestamp, in milliseconds, is revoked.
+// Deadline is in milliseconds as well, so that it takes effect immediately,
+// while tokens issued right after it, e.g. when password is changed, are still valid.
 func IsJWTRevoked(id string, timestamp int64) (interface{}, bool) {
 	key := addPrefix(id)
 	unixTime, err := client.Get(key).Result()
 	if err != nil {
 		return id, false
 	}
-	log.Println(unixTime)
-	loginTime, _ := strconv.ParseInt(unixTime, 10, 64)
-	if timestamp < loginTime-3 {
+	deadline, _ := strconv.ParseInt(unixTime, 10, 64)
+	if timestamp < toMilli(deadline) {
 		return nil, true
 	}
 	return id, false
 }
+
+// toMilli converts a timestamp to milliseconds, if it has been stored in seconds by earlier versions.
+func toMilli(timestamp int64) int64 {
+	if timestamp < 1e12 {
+		return timestamp * 1000
+	}
+	return timestamp
+}
+
+// LockKeyRotation makes sure only one server rotates signing keys of JWT in a while.
+func LockKeyRotation(ttl time.Duration) (bool, error) {
+	return client.SetNX("jwt_key_rotation", time.Now().Unix(), ttl).Result()
+}
@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRevokeJWT(t *testing.T) {
+	requireRedis(t)
+	assert := assert.New(t)
+	id := "test-revoke"
+	defer client.Del(addPrefix(id))
+
+	before := time.Now().UnixMilli()
+	_, revoked := IsJWTRevoked(id, before)
+	assert.False(revoked)
+
+	time.Sleep(5 * time.Millisecond)
+	assert.Nil(RevokeJWT(id))
+	// tokens issued just before the deadline are revoked at once, and those issued after it are valid.
+	_, revoked = IsJWTRevoked(id, before)
+	assert.True(revoked)
+	time.Sleep(5 * time.Millisecond)
+	_, revoked = IsJWTRevoked(id, time.Now().UnixMilli())
+	assert.False(revoked)
+
+	// deadlines stored in seconds by earlier versions still work.
+	deadline := time.Now().Unix()
+	client.Set(addPrefix(id), deadline, time.Minute)
+	_, revoked = IsJWTRevoked(id, deadline*1000-1)
+	assert.True(revoked)
+	_, revoked = IsJWTRevoked(id, deadline*1000)
+	assert.False(revoked)
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/util/randutil"
+	"github.com/go-redis/redis"
+	"strconv"
+)
+
+const PrefixWebAuthn = "webauthn:"
+
+// SetWebAuthnChallenge stores challenge of a WebAuthn ceremony and returns id of the ceremony.
+// uid is the user who registers or logs in, zero means user is unknown until a passkey is chosen.
+func SetWebAuthnChallenge(challenge string, uid int64) (string, error) {
+	id, err := randutil.Token(16)
+	if err != nil {
+		return "", err
+	}
+	_, err = client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet(PrefixWebAuthn+id, map[string]interface{}{"challenge": challenge, "uid": uid})
+		pipe.Expire(PrefixWebAuthn+id, Config.WebAuthnTimeout)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// ConsumeWebAuthnChallenge returns challenge and user of a ceremony.
+// A challenge can only be consumed once, no matter the ceremony succeeds or not.
+func ConsumeWebAuthnChallenge(id string) (string, int64, error) {
+	key := PrefixWebAuthn + id
+	var get *redis.StringStringMapCmd
+	if _, err := client.TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.HGetAll(key)
+		pipe.Del(key)
+		return nil
+	}); err != nil {
+		return "", 0, errs.New(err)
+	}
+
+	ceremony := get.Val()
+	uid, err := strconv.ParseInt(ceremony["uid"], 10, 64)
+	if err != nil || ceremony["challenge"] == "" {
+		return "", 0, errs.ErrInvalidToken
+	}
+	return ceremony["challenge"], uid, nil
+}
@@ -5,7 +5,10 @@ import (
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
+	"strings"
+	"testing"
 	"time"
 )
 
@@ -15,6 +18,20 @@ type configuration struct {
 	*Redis
 	*JWT
 	*Storage
+	*Email
+	*Account
+	*Session
+	*I18n
+	*Validation
+	*LoginThrottle `yaml:"login_throttle"`
+	*RateLimiting  `yaml:"rate_limit"`
+	*Captcha
+	*QRLogin `yaml:"qr_login"`
+	*OTP
+	*MFA
+	*WebAuthn `yaml:"webauthn"`
+	*OAuth
+	*AuthServer `yaml:"authorization_server"`
 }
 
 type Database struct {
@@ -27,10 +44,14 @@ type Database struct {
 }
 
 type Server struct {
-	RunMode      string
+	RunMode      string `yaml:"run_mode"` // debug, release or test
 	Port         string
+	BaseURL      string        `yaml:"base_url"`
+	AuthMode     string        `yaml:"auth_mode"` // jwt, session or both
 	ReadTimeout  time.Duration `yaml:"read_timeout"`
 	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// TrustedProxies are addresses or CIDRs of reverse proxies, only whose X-Forwarded-For headers are believed.
+	TrustedProxies []string `yaml:"trusted_proxies"`
 }
 
 type Redis struct {
@@ -40,12 +61,18 @@ type Redis struct {
 }
 
 type JWT struct {
-	SigningAlgorithm string        `yaml:"signing_algorithm"`
-	AccessSecret     string        `yaml:"access_secret"`
+	SigningAlgorithm string        `yaml:"signing_algorithm"` // HS256, HS384, HS512, RS256, ES256, EdDSA and so on
+	AccessSecret     string        `yaml:"access_secret"`     // for HMAC algorithms
 	RefreshSecret    string        `yaml:"refresh_secret"`
+	AccessKeyFile    string        `yaml:"access_key"` // PEM private key for asymmetric algorithms
+	RefreshKeyFile   string        `yaml:"refresh_key"`
 	Timeout          time.Duration `yaml:"duration"`
 	Issuer           string
 	MaxRefreshTime   time.Duration `yaml:"max_refresh_time"`
+	// KeyRotationInterval rotates signing keys automatically, zero means they are only rotated by administrators.
+	KeyRotationInterval time.Duration `yaml:"key_rotation_interval"`
+	// KeyEncryptionKey encrypts signing keys in database, which are never stored in plaintext.
+	KeyEncryptionKey string `yaml:"key_encryption_key"`
 }
 
 type Storage struct {
@@ -56,6 +83,165 @@ type Image struct {
 	AvatarPath string `yaml:"avatar"`
 }
 
+type Email struct {
+	MailDriver   string `yaml:"driver"` // smtp or log
+	MailHost     string `yaml:"host"`
+	MailPort     string `yaml:"port"`
+	MailUsername string `yaml:"username"`
+	MailPassword string `yaml:"password"`
+	MailFrom     string `yaml:"from"`
+	MailFile     string `yaml:"file"` // where log driver writes emails, empty means stderr
+	TemplatePath string `yaml:"template_path"`
+}
+
+type Account struct {
+	ActivationTimeout  time.Duration `yaml:"activation_timeout"`
+	ResetTimeout       time.Duration `yaml:"reset_timeout"`
+	EmailChangeTimeout time.Duration `yaml:"email_change_timeout"`
+	PasswordHistory    int           `yaml:"password_history"` // how many recent passwords can't be reused
+	PasswordMaxAge     time.Duration `yaml:"password_max_age"` // zero means passwords never expire
+}
+
+type Session struct {
+	CookieName     string        `yaml:"cookie_name"`
+	CookieDomain   string        `yaml:"cookie_domain"`
+	CookieSecure   *bool         `yaml:"cookie_secure"` // true unless it is set to false
+	SessionTimeout time.Duration `yaml:"timeout"`       // a session expires if it is idle for so long
+	MaxLifetime    time.Duration `yaml:"max_lifetime"`  // a session expires anyway after so long
+}
+
+type I18n struct {
+	LocalePath      string `yaml:"path"`
+	DefaultLanguage string `yaml:"default_language"`
+}
+
+type Validation struct {
+	UsernameMinLength int    `yaml:"username_min_length"`
+	UsernameMaxLength int    `yaml:"username_max_length"`
+	PasswordMinLength int    `yaml:"password_min_length"`
+	PasswordMaxLength int    `yaml:"password_max_length"`
+	PasswordSymbols   string `yaml:"password_symbols"`
+	RequireLower      bool   `yaml:"require_lower"`
+	RequireUpper      bool   `yaml:"require_upper"`
+	RequireDigit      bool   `yaml:"require_digit"`
+	RequireSymbol     bool   `yaml:"require_symbol"`
+	DictionaryFile    string `yaml:"dictionary_file"`  // common passwords, one per line
+	BreachedFile      string `yaml:"breached_file"`    // sorted SHA-1 hashes of breached passwords
+	CellphoneFormat   string `yaml:"cellphone_format"` // cn, e164 or any
+}
+
+// LoginThrottle locks an account or an IP after too many failed logins.
+// Lock duration doubles on each further failure, from LockDuration up to MaxLockDuration.
+type LoginThrottle struct {
+	AccountThreshold int           `yaml:"account_threshold"`
+	IPThreshold      int           `yaml:"ip_threshold"`
+	LockDuration     time.Duration `yaml:"lock_duration"`
+	MaxLockDuration  time.Duration `yaml:"max_lock_duration"`
+	FailureWindow    time.Duration `yaml:"failure_window"` // failures are forgotten after so long without another one
+}
+
+type RateLimiting struct {
+	RateLimitStore string                    `yaml:"store"` // memory or redis
+	RateLimitRules map[string]*RateLimitRule `yaml:"rules"` // keyed by name of rule
+}
+
+// RateLimitRule allows Limit requests in Window for each key.
+type RateLimitRule struct {
+	Algorithm string        `yaml:"algorithm"` // token_bucket or sliding_window
+	Key       string        `yaml:"key"`       // ip, user or route
+	Limit     int           `yaml:"limit"`
+	Window    time.Duration `yaml:"window"`
+}
+
+// Rate limit algorithms and keys.
+const (
+	AlgorithmTokenBucket   = "token_bucket"
+	AlgorithmSlidingWindow = "sliding_window"
+
+	LimitByIP    = "ip"
+	LimitByUser  = "user"
+	LimitByRoute = "route"
+)
+
+type Captcha struct {
+	CaptchaLength    int           `yaml:"length"`
+	CaptchaWidth     int           `yaml:"width"`
+	CaptchaHeight    int           `yaml:"height"`
+	CaptchaTimeout   time.Duration `yaml:"timeout"`
+	CaptchaThreshold int           `yaml:"login_threshold"` // login requires captcha after so many failures
+}
+
+type QRLogin struct {
+	QRTicketTimeout time.Duration `yaml:"timeout"`      // how long a QR code can be scanned and confirmed
+	QRPollTimeout   time.Duration `yaml:"poll_timeout"` // how long a long-polling request waits for a change
+	QRSize          int           `yaml:"size"`
+}
+
+// OTP configures one-time codes sent by SMS.
+type OTP struct {
+	OTPTimeout     time.Duration `yaml:"timeout"`
+	OTPInterval    time.Duration `yaml:"interval"`     // a cellphone can only receive one code in interval
+	OTPHourlyLimit int           `yaml:"hourly_limit"` // how many codes a cellphone can receive in an hour
+}
+
+// MFA configures two-factor authentication by TOTP.
+type MFA struct {
+	MFAIssuer         string        `yaml:"issuer"`          // shown in authenticator apps
+	MFAPendingTimeout time.Duration `yaml:"pending_timeout"` // how long the second step of login can wait
+	MFARecoveryCodes  int           `yaml:"recovery_codes"`  // how many recovery codes a user gets
+}
+
+// WebAuthn configures the relying party of passkeys.
+type WebAuthn struct {
+	WebAuthnRPID    string        `yaml:"rp_id"`   // domain which passkeys are scoped to, host of base url by default
+	WebAuthnRPName  string        `yaml:"rp_name"` // shown by authenticators
+	WebAuthnOrigins []string      `yaml:"origins"` // where passkeys can be used, base url by default
+	WebAuthnTimeout time.Duration `yaml:"timeout"` // how long a ceremony can take
+	// WebAuthnUserVerification rejects authenticators which don't verify user by PIN or biometrics.
+	WebAuthnUserVerification bool `yaml:"require_user_verification"`
+}
+
+// OAuth configures external providers which users can log in with.
+type OAuth struct {
+	OAuthProviders    map[string]*OAuthProvider `yaml:"providers"`     // keyed by name of provider, e.g. google
+	OAuthStateTimeout time.Duration             `yaml:"state_timeout"` // how long user can take to authorize
+}
+
+// OAuthProvider is an OAuth 2.0 provider, or an OpenID Connect provider if Issuer is set.
+type OAuthProvider struct {
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	AuthStyle    string   `yaml:"auth_style"`   // basic or post, how client authenticates at token endpoint
+	RedirectURL  string   `yaml:"redirect_url"` // base_url/auth/oauth/{name}/callback by default
+	Scopes       []string `yaml:"scopes"`
+	AuthURL      string   `yaml:"auth_url"`
+	TokenURL     string   `yaml:"token_url"`
+	UserInfoURL  string   `yaml:"userinfo_url"`
+	Issuer       string   `yaml:"issuer"`
+	JWKSURL      string   `yaml:"jwks_url"`
+	// Fields of user info for providers which don't follow OpenID Connect, e.g. id and login of GitHub.
+	SubjectField  string `yaml:"subject_field"`
+	EmailField    string `yaml:"email_field"`
+	NameField     string `yaml:"name_field"`
+	EmailVerified bool   `yaml:"email_verified"` // provider only returns verified emails
+	// LinkByEmail links a new external account to the user with the same verified email address.
+	// Only enable it if the provider can be trusted to verify emails.
+	LinkByEmail bool `yaml:"link_by_email"`
+}
+
+// AuthServer configures Pandora as an OAuth 2.0 authorization server of other apps.
+// Tokens issued to apps live as long as access tokens and refresh tokens of JWT.
+type AuthServer struct {
+	AuthCodeTimeout time.Duration `yaml:"code_timeout"` // how long an authorization code can wait to be redeemed
+}
+
+// Authentication modes.
+const (
+	AuthJWT     = "jwt"
+	AuthSession = "session"
+	AuthBoth    = "both"
+)
+
 var Config configuration
 
 func init() {
@@ -65,11 +251,32 @@ func init() {
 	checkRedis()
 	checkJWT()
 	//checkStorage()
+	checkEmail()
+	checkAccount()
+	checkSession()
+	checkI18n()
+	checkValidation()
+	checkLoginThrottle()
+	checkRateLimit()
+	checkCaptcha()
+	checkQRLogin()
+	checkOTP()
+	checkMFA()
+	checkWebAuthn()
+	checkOAuth()
+	checkAuthServer()
 }
 
+// loadConfig reads conf/config.yaml.
+// Tests can run without it, then database, server and Redis are left empty and other sections take defaults,
+// so that tests which don't need them can still run.
 func loadConfig() {
 	data, err := ioutil.ReadFile("conf/config.yaml")
-	if err != nil {
+	if os.IsNotExist(err) && testing.Testing() {
+		log.Println("config file is missing, defaults are used for tests")
+		Config = configuration{Database: &Database{}, Server: &Server{}, Redis: &Redis{}}
+		return
+	} else if err != nil {
 		log.Panicln("failed to load config file")
 	}
 	if err = yaml.Unmarshal(data, &Config); err != nil {
@@ -87,6 +294,16 @@ func checkServer() {
 	if Config.Server == nil {
 		log.Panicln("failed to init server configuration")
 	}
+	if Config.BaseURL == "" {
+		Config.BaseURL = "http://localhost:" + Config.Port
+	}
+	switch Config.AuthMode {
+	case AuthJWT, AuthSession, AuthBoth:
+	case "":
+		Config.AuthMode = AuthJWT
+	default:
+		log.Panicf("unknown auth mode: %s", Config.AuthMode)
+	}
 }
 
 func checkRedis() {
@@ -95,18 +312,41 @@ func checkRedis() {
 	}
 }
 
+// Default secrets of JWT are public, they are only for development.
+const (
+	defaultAccessSecret  = "Hatsune Miku"
+	defaultRefreshSecret = "Miku-chan maji tenshi"
+	defaultKeyEncryption = "Miku-chan no himitsu"
+)
+
 func checkJWT() {
 	if Config.JWT == nil {
 		log.Println("failed to init jwt configuration, use default jwt config...")
 		Config.JWT = &JWT{}
 		Config.Timeout = time.Hour
 		Config.MaxRefreshTime = 7 * 24 * time.Hour
-		Config.AccessSecret = "Hatsune Miku"
-		Config.RefreshSecret = "Miku-chan maji tenshi"
+		Config.AccessSecret = defaultAccessSecret
+		Config.RefreshSecret = defaultRefreshSecret
 		Config.Issuer = "Fallensouls"
+		Config.KeyEncryptionKey = defaultKeyEncryption
 	} else {
 		Config.Timeout *= time.Minute
 		Config.MaxRefreshTime *= time.Hour
+		Config.KeyRotationInterval *= 24 * time.Hour
+	}
+	hmac := Config.SigningAlgorithm == "" || strings.HasPrefix(Config.SigningAlgorithm, "HS")
+	if hmac && Config.RunMode == "release" {
+		for _, secret := range []string{Config.AccessSecret, Config.RefreshSecret} {
+			if secret == "" || secret == defaultAccessSecret || secret == defaultRefreshSecret {
+				log.Panicln("jwt secrets must be set to your own in release mode")
+			}
+		}
+	}
+	if Config.KeyEncryptionKey == "" || Config.KeyEncryptionKey == defaultKeyEncryption {
+		if Config.RunMode == "release" {
+			log.Panicln("jwt key encryption key must be set to your own in release mode")
+		}
+		Config.KeyEncryptionKey = defaultKeyEncryption
 	}
 }
 
@@ -120,3 +360,303 @@ func checkStorage() {
 	}
 
 }
+
+func checkEmail() {
+	if Config.Email == nil {
+		log.Println("failed to init mail configuration, emails will be written to log...")
+		Config.Email = &Email{MailDriver: "log"}
+	}
+	if Config.TemplatePath == "" {
+		Config.TemplatePath = "templates"
+	}
+}
+
+func checkAccount() {
+	if Config.Account == nil {
+		Config.Account = &Account{}
+	}
+	if Config.ActivationTimeout <= 0 {
+		Config.ActivationTimeout = 24
+	}
+	Config.ActivationTimeout *= time.Hour
+	if Config.ResetTimeout <= 0 {
+		Config.ResetTimeout = 15
+	}
+	Config.ResetTimeout *= time.Minute
+	if Config.EmailChangeTimeout <= 0 {
+		Config.EmailChangeTimeout = 24
+	}
+	Config.EmailChangeTimeout *= time.Hour
+	if Config.PasswordHistory == 0 {
+		Config.PasswordHistory = 5
+	}
+	if Config.PasswordMaxAge < 0 {
+		Config.PasswordMaxAge = 0
+	}
+	Config.PasswordMaxAge *= 24 * time.Hour
+}
+
+func checkSession() {
+	if Config.Session == nil {
+		Config.Session = &Session{}
+	}
+	if Config.CookieSecure == nil {
+		secure := true
+		Config.CookieSecure = &secure
+	}
+	if Config.CookieName == "" {
+		Config.CookieName = "pandora_session"
+	}
+	if Config.SessionTimeout <= 0 {
+		Config.SessionTimeout = 30
+	}
+	Config.SessionTimeout *= time.Minute
+	if Config.MaxLifetime <= 0 {
+		Config.MaxLifetime = 7 * 24
+	}
+	Config.MaxLifetime *= time.Hour
+}
+
+func checkI18n() {
+	if Config.I18n == nil {
+		Config.I18n = &I18n{}
+	}
+	if Config.LocalePath == "" {
+		Config.LocalePath = "locales"
+	}
+	if Config.DefaultLanguage == "" {
+		Config.DefaultLanguage = "en"
+	}
+}
+
+func checkValidation() {
+	if Config.Validation == nil {
+		Config.Validation = &Validation{}
+	}
+	switch Config.CellphoneFormat {
+	case "", "cn", "e164", "any":
+	default:
+		log.Panicf("unknown cellphone format: %s", Config.CellphoneFormat)
+	}
+}
+
+func checkLoginThrottle() {
+	if Config.LoginThrottle == nil {
+		Config.LoginThrottle = &LoginThrottle{}
+	}
+	if Config.AccountThreshold <= 0 {
+		Config.AccountThreshold = 5
+	}
+	if Config.IPThreshold <= 0 {
+		Config.IPThreshold = 20
+	}
+	if Config.LockDuration <= 0 {
+		Config.LockDuration = 60
+	}
+	Config.LockDuration *= time.Second
+	if Config.MaxLockDuration <= 0 {
+		Config.MaxLockDuration = 60
+	}
+	Config.MaxLockDuration *= time.Minute
+	if Config.FailureWindow <= 0 {
+		Config.FailureWindow = 24
+	}
+	Config.FailureWindow *= time.Hour
+}
+
+// defaultRateLimitRules protects routes which are most likely to be abused.
+var defaultRateLimitRules = map[string]RateLimitRule{
+	"register":       {Algorithm: AlgorithmSlidingWindow, Key: LimitByIP, Limit: 10, Window: 3600},
+	"activation":     {Algorithm: AlgorithmSlidingWindow, Key: LimitByIP, Limit: 5, Window: 3600},
+	"avatar":         {Algorithm: AlgorithmTokenBucket, Key: LimitByUser, Limit: 10, Window: 60},
+	"captcha":        {Algorithm: AlgorithmTokenBucket, Key: LimitByIP, Limit: 30, Window: 60},
+	"qr_login":       {Algorithm: AlgorithmTokenBucket, Key: LimitByIP, Limit: 30, Window: 60},
+	"sms":            {Algorithm: AlgorithmSlidingWindow, Key: LimitByIP, Limit: 10, Window: 3600},
+	"mfa":            {Algorithm: AlgorithmSlidingWindow, Key: LimitByUser, Limit: 10, Window: 600},
+	"mfa_login":      {Algorithm: AlgorithmSlidingWindow, Key: LimitByIP, Limit: 30, Window: 600}, // pending logins carry no user
+	"webauthn":       {Algorithm: AlgorithmTokenBucket, Key: LimitByIP, Limit: 30, Window: 60},
+	"oauth":          {Algorithm: AlgorithmTokenBucket, Key: LimitByIP, Limit: 30, Window: 60},
+	"email":          {Algorithm: AlgorithmSlidingWindow, Key: LimitByUser, Limit: 5, Window: 3600},
+	"password_reset": {Algorithm: AlgorithmSlidingWindow, Key: LimitByIP, Limit: 10, Window: 3600},
+}
+
+func checkRateLimit() {
+	if Config.RateLimiting == nil {
+		Config.RateLimiting = &RateLimiting{}
+	}
+	switch Config.RateLimitStore {
+	case "memory", "redis":
+	case "":
+		Config.RateLimitStore = "redis"
+	default:
+		log.Panicf("unknown rate limit store: %s", Config.RateLimitStore)
+	}
+	if Config.RateLimitRules == nil {
+		Config.RateLimitRules = make(map[string]*RateLimitRule)
+	}
+	for name, rule := range defaultRateLimitRules {
+		if _, ok := Config.RateLimitRules[name]; !ok {
+			rule := rule
+			Config.RateLimitRules[name] = &rule
+		}
+	}
+	for name, rule := range Config.RateLimitRules {
+		switch rule.Algorithm {
+		case AlgorithmTokenBucket, AlgorithmSlidingWindow:
+		case "":
+			rule.Algorithm = AlgorithmSlidingWindow
+		default:
+			log.Panicf("unknown rate limit algorithm of rule %s: %s", name, rule.Algorithm)
+		}
+		switch rule.Key {
+		case LimitByIP, LimitByUser, LimitByRoute:
+		case "":
+			rule.Key = LimitByIP
+		default:
+			log.Panicf("unknown rate limit key of rule %s: %s", name, rule.Key)
+		}
+		if rule.Limit <= 0 || rule.Window <= 0 {
+			log.Panicf("limit and window of rate limit rule %s must be positive", name)
+		}
+		rule.Window *= time.Second
+	}
+}
+
+func checkCaptcha() {
+	if Config.Captcha == nil {
+		Config.Captcha = &Captcha{}
+	}
+	if Config.CaptchaLength <= 0 {
+		Config.CaptchaLength = 5
+	}
+	if Config.CaptchaWidth <= 0 {
+		Config.CaptchaWidth = 150
+	}
+	if Config.CaptchaHeight <= 0 {
+		Config.CaptchaHeight = 50
+	}
+	if Config.CaptchaTimeout <= 0 {
+		Config.CaptchaTimeout = 5
+	}
+	Config.CaptchaTimeout *= time.Minute
+	if Config.CaptchaThreshold <= 0 {
+		Config.CaptchaThreshold = 3
+	}
+}
+
+func checkQRLogin() {
+	if Config.QRLogin == nil {
+		Config.QRLogin = &QRLogin{}
+	}
+	if Config.QRTicketTimeout <= 0 {
+		Config.QRTicketTimeout = 120
+	}
+	Config.QRTicketTimeout *= time.Second
+	if Config.QRPollTimeout <= 0 {
+		Config.QRPollTimeout = 25
+	}
+	Config.QRPollTimeout *= time.Second
+	if Config.QRSize <= 0 {
+		Config.QRSize = 256
+	}
+}
+
+func checkOTP() {
+	if Config.OTP == nil {
+		Config.OTP = &OTP{}
+	}
+	if Config.OTPTimeout <= 0 {
+		Config.OTPTimeout = 5
+	}
+	Config.OTPTimeout *= time.Minute
+	if Config.OTPInterval <= 0 {
+		Config.OTPInterval = 60
+	}
+	Config.OTPInterval *= time.Second
+	if Config.OTPHourlyLimit <= 0 {
+		Config.OTPHourlyLimit = 5
+	}
+}
+
+func checkMFA() {
+	if Config.MFA == nil {
+		Config.MFA = &MFA{}
+	}
+	if Config.MFAIssuer == "" {
+		Config.MFAIssuer = "Pandora"
+	}
+	if Config.MFAPendingTimeout <= 0 {
+		Config.MFAPendingTimeout = 5
+	}
+	Config.MFAPendingTimeout *= time.Minute
+	if Config.MFARecoveryCodes <= 0 {
+		Config.MFARecoveryCodes = 10
+	}
+}
+
+func checkWebAuthn() {
+	if Config.WebAuthn == nil {
+		Config.WebAuthn = &WebAuthn{}
+	}
+	if Config.WebAuthnRPID == "" {
+		base, err := url.Parse(Config.BaseURL)
+		if err != nil {
+			log.Panicf("failed to parse base url: %s", err)
+		}
+		Config.WebAuthnRPID = base.Hostname()
+	}
+	if Config.WebAuthnRPName == "" {
+		Config.WebAuthnRPName = "Pandora"
+	}
+	if len(Config.WebAuthnOrigins) == 0 {
+		Config.WebAuthnOrigins = []string{strings.TrimRight(Config.BaseURL, "/")}
+	}
+	if Config.WebAuthnTimeout <= 0 {
+		Config.WebAuthnTimeout = 120
+	}
+	Config.WebAuthnTimeout *= time.Second
+}
+
+func checkOAuth() {
+	if Config.OAuth == nil {
+		Config.OAuth = &OAuth{}
+	}
+	if Config.OAuthStateTimeout <= 0 {
+		Config.OAuthStateTimeout = 10
+	}
+	Config.OAuthStateTimeout *= time.Minute
+	for name, provider := range Config.OAuthProviders {
+		if provider.ClientID == "" || provider.AuthURL == "" || provider.TokenURL == "" {
+			log.Panicf("client id, auth url and token url of oauth provider %s are required", name)
+		}
+		if provider.Issuer != "" && provider.JWKSURL == "" {
+			log.Panicf("jwks url of openid connect provider %s is required", name)
+		}
+		if provider.Issuer == "" && provider.UserInfoURL == "" {
+			log.Panicf("userinfo url of oauth provider %s is required", name)
+		}
+		switch provider.AuthStyle {
+		case "basic", "post":
+		case "":
+			provider.AuthStyle = "basic"
+		default:
+			log.Panicf("unknown auth style of oauth provider %s: %s", name, provider.AuthStyle)
+		}
+		if provider.RedirectURL == "" {
+			provider.RedirectURL = strings.TrimRight(Config.BaseURL, "/") + "/auth/oauth/" + name + "/callback"
+		}
+		if len(provider.Scopes) == 0 && provider.Issuer != "" {
+			provider.Scopes = []string{"openid", "email", "profile"}
+		}
+	}
+}
+
+func checkAuthServer() {
+	if Config.AuthServer == nil {
+		Config.AuthServer = &AuthServer{}
+	}
+	if Config.AuthCodeTimeout <= 0 {
+		Config.AuthCodeTimeout = 60
+	}
+	Config.AuthCodeTimeout *= time.Second
+}
@@ -0,0 +1,46 @@
+package conf
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+	"testing"
+)
+
+func TestServer_RunMode(t *testing.T) {
+	var c configuration
+	assert.Nil(t, yaml.Unmarshal([]byte("server:\n  run_mode: release\n"), &c))
+	if assert.NotNil(t, c.Server) {
+		assert.Equal(t, "release", c.RunMode)
+	}
+}
+
+func TestCheckJWT_Release(t *testing.T) {
+	saved := Config
+	defer func() { Config = saved }()
+
+	tests := []struct {
+		name   string
+		jwt    *JWT
+		panics bool
+	}{
+		{"default config", nil, true},
+		{"default access secret", &JWT{AccessSecret: defaultAccessSecret, RefreshSecret: "refresh", KeyEncryptionKey: "kek"}, true},
+		{"default refresh secret", &JWT{AccessSecret: "access", RefreshSecret: defaultRefreshSecret, KeyEncryptionKey: "kek"}, true},
+		{"empty secret", &JWT{AccessSecret: "access", KeyEncryptionKey: "kek"}, true},
+		{"default key encryption key", &JWT{AccessSecret: "access", RefreshSecret: "refresh", KeyEncryptionKey: defaultKeyEncryption}, true},
+		{"empty key encryption key", &JWT{AccessSecret: "access", RefreshSecret: "refresh"}, true},
+		{"own secrets", &JWT{AccessSecret: "access", RefreshSecret: "refresh", KeyEncryptionKey: "kek"}, false},
+		// secrets are not used by asymmetric algorithms.
+		{"asymmetric", &JWT{SigningAlgorithm: "ES256", KeyEncryptionKey: "kek"}, false},
+	}
+	for _, test := range tests {
+		for _, mode := range []string{"release", "debug"} {
+			Config.Server, Config.JWT = &Server{RunMode: mode}, test.jwt
+			if test.panics && mode == "release" {
+				assert.Panics(t, checkJWT, test.name)
+			} else {
+				assert.NotPanics(t, checkJWT, test.name+" in "+mode)
+			}
+		}
+	}
+}
@@ -1,9 +1,23 @@
 package errs
 
+// ErrMap assigns a stable code to each error.
+// Every error defined in this package should be registered here, and a code should never be reused.
+// Translations of messages are in locales, keyed by these codes.
 var ErrMap = map[string]error{
 	"1001": ErrInvalidParam,
 	"1002": ErrInvalidData,
 	"1003": ErrInvalidToken,
+	"1004": ErrInvalidCode,
+	"1005": ErrValidation,
+	"1006": ErrTooManyRequests,
+	"1007": ErrCaptchaRequired,
+	"1008": ErrInvalidCaptcha,
+
+	"1101": ErrInvalidAuthHeader,
+	"1102": ErrUnauthenticated,
+	"1103": ErrUnauthorized,
+	"1104": ErrQRCodeExpired,
+	"1105": ErrQRCodeUsed,
 
 	"20001": ErrInfoRequired,
 	"20002": ErrInvalidUsername,
@@ -20,4 +34,39 @@ var ErrMap = map[string]error{
 	"20013": ErrCellphoneUsed,
 	"20014": ErrUserLogin,
 	"20015": ErrUserLogout,
+	"20016": ErrUserActivated,
+	"20017": ErrUserNormal,
+	"20018": ErrInvalidLanguage,
+	"20019": ErrInvalidAge,
+	"20020": ErrInvalidGender,
+	"20021": ErrInvalidDescription,
+	"20022": ErrPasswordTooWeak,
+	"20023": ErrPasswordTooCommon,
+	"20024": ErrPasswordBreached,
+	"20025": ErrPasswordContainsUsername,
+	"20026": ErrPasswordReused,
+	"20027": ErrPasswordExpired,
+	"20028": ErrTooManyAttempts,
+	"20029": ErrMFAEnabled,
+	"20030": ErrMFANotEnabled,
+	"20031": ErrMFARequired,
+	"20032": ErrInvalidPasskey,
+	"20033": ErrPasskeyNotFound,
+	"20034": ErrPasskeyRegistered,
+	"20035": ErrProviderNotFound,
+	"20036": ErrOAuthFailed,
+	"20037": ErrIdentityLinked,
+	"20038": ErrAccountExists,
+	"20039": ErrPasswordNotExpired,
+	"20040": ErrLastLoginMethod,
+
+	"30001": ErrRoleNotFound,
+	"30002": ErrReasonRequired,
+
+	"40001": ErrInvalidImage,
+
+	"50001": ErrClientNotFound,
+	"50002": ErrInvalidRedirectURI,
+	"50003": ErrInvalidScope,
+	"50004": ErrPKCERequired,
 }
@@ -1,45 +1,144 @@
 // Package errs defines all possible errors may occur in runtime.
 package errs
 
+import (
+	"net/http"
+	"strconv"
+)
+
+// Err is an error which can be shown to users.
+// Code is a stable number for frontend to distinguish errors, which is assigned by ErrMap.
+// Status is the HTTP status of response.
 type Err struct {
 	SystemError bool
+	Code        int
+	Status      int
 	Message     string
+	Details     []FieldError
+}
+
+// FieldError describes which field of request is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
 }
 
 func (e *Err) Error() string {
 	return e.Message
 }
 
+// Field describes that field is invalid because of error e.
+func Field(field string, e *Err) FieldError {
+	return FieldError{Field: field, Code: e.Code, Message: e.Message}
+}
+
+// WithDetails returns a copy of error with field-level details.
+func (e *Err) WithDetails(details ...FieldError) *Err {
+	err := *e
+	err.Details = details
+	return &err
+}
+
+// New wraps an unexpected error as a system error.
+// Its message will only be logged and never be shown to users.
 func New(err error) error {
-	return &Err{true, err.Error()}
+	return &Err{SystemError: true, Code: CodeSystemError, Status: http.StatusInternalServerError, Message: err.Error()}
+}
+
+// CodeSystemError is code of all system errors.
+const CodeSystemError = 1000
+
+func init() {
+	for code, err := range ErrMap {
+		e := err.(*Err)
+		e.Code, _ = strconv.Atoi(code)
+		if e.Status == 0 {
+			e.Status = http.StatusBadRequest
+		}
+	}
 }
 
 var (
 	ErrInvalidParam = &Err{Message: "invalid param"}
 	ErrInvalidData  = &Err{Message: "invalid data"}
-	ErrInvalidToken = &Err{Message: "invalid token"}
+	ErrInvalidToken = &Err{Message: "invalid token", Status: http.StatusUnauthorized}
+	ErrInvalidCode  = &Err{Message: "your verification code is invalid or expired"}
+	ErrValidation   = &Err{Message: "some fields are invalid"}
+
+	ErrTooManyRequests = &Err{Message: "too many requests, please try again later", Status: http.StatusTooManyRequests}
+	ErrCaptchaRequired = &Err{Message: "please complete the captcha"}
+	ErrInvalidCaptcha  = &Err{Message: "captcha is incorrect or expired"}
+)
+
+var (
+	ErrInvalidAuthHeader = &Err{Message: "your auth header is invalid", Status: http.StatusUnauthorized}
+	ErrUnauthenticated   = &Err{Message: "please login", Status: http.StatusUnauthorized}
+	ErrUnauthorized      = &Err{Message: "you are not authorized", Status: http.StatusForbidden}
+	ErrQRCodeExpired     = &Err{Message: "this QR code has expired, please refresh it"}
+	ErrQRCodeUsed        = &Err{Message: "this QR code has been used", Status: http.StatusConflict}
+)
+
+var (
+	ErrInfoRequired       = &Err{Message: "please provide a valid email address or a cellphone number"}
+	ErrInvalidUsername    = &Err{Message: "your username is not valid"}
+	ErrInvalidPassword    = &Err{Message: "your password is not valid"}
+	ErrInvalidEmail       = &Err{Message: "your email address is not valid"}
+	ErrInvalidCellphone   = &Err{Message: "your cellphone number is not valid"}
+	ErrUserNotFound       = &Err{Message: "this account does not exist", Status: http.StatusNotFound}
+	ErrUserInactive       = &Err{Message: "please activate your account first", Status: http.StatusForbidden}
+	ErrUserRestricted     = &Err{Message: "this account has been restricted", Status: http.StatusForbidden}
+	ErrUserBanned         = &Err{Message: "this account has been banned", Status: http.StatusForbidden}
+	ErrWrongPassword      = &Err{Message: "incorrect password", Status: http.StatusUnauthorized}
+	ErrEncodingPassword   = &Err{Message: "failed to encode your password", Status: http.StatusInternalServerError}
+	ErrEmailUsed          = &Err{Message: "this email address has already been used", Status: http.StatusConflict}
+	ErrCellphoneUsed      = &Err{Message: "this cellphone number has already been used", Status: http.StatusConflict}
+	ErrUserLogin          = &Err{Message: "you have logged in", Status: http.StatusConflict}
+	ErrUserLogout         = &Err{Message: "you have logged out", Status: http.StatusConflict}
+	ErrUserActivated      = &Err{Message: "this account has already been activated", Status: http.StatusConflict}
+	ErrUserNormal         = &Err{Message: "this account is neither restricted nor banned", Status: http.StatusConflict}
+	ErrInvalidLanguage    = &Err{Message: "this language is not supported"}
+	ErrInvalidAge         = &Err{Message: "your age is not valid"}
+	ErrInvalidGender      = &Err{Message: "your gender is not valid"}
+	ErrInvalidDescription = &Err{Message: "your description is too long"}
+
+	ErrPasswordTooWeak          = &Err{Message: "your password does not contain required kinds of characters"}
+	ErrPasswordTooCommon        = &Err{Message: "your password is too common"}
+	ErrPasswordBreached         = &Err{Message: "your password has appeared in a data breach"}
+	ErrPasswordContainsUsername = &Err{Message: "your password must not contain your username"}
+	ErrPasswordReused           = &Err{Message: "you have used this password recently"}
+	ErrPasswordExpired          = &Err{Message: "your password has expired, please change it", Status: http.StatusForbidden}
+	ErrTooManyAttempts          = &Err{Message: "too many failed logins, please try again later", Status: http.StatusTooManyRequests}
+
+	ErrMFAEnabled    = &Err{Message: "two-factor authentication has already been enabled", Status: http.StatusConflict}
+	ErrMFANotEnabled = &Err{Message: "two-factor authentication is not enabled"}
+	ErrMFARequired   = &Err{Message: "two-factor authentication is required for your roles", Status: http.StatusForbidden}
+
+	ErrInvalidPasskey    = &Err{Message: "your passkey could not be verified", Status: http.StatusUnauthorized}
+	ErrPasskeyNotFound   = &Err{Message: "this passkey is not registered", Status: http.StatusNotFound}
+	ErrPasskeyRegistered = &Err{Message: "this passkey has already been registered", Status: http.StatusConflict}
+
+	ErrProviderNotFound = &Err{Message: "this login provider is not supported", Status: http.StatusNotFound}
+	ErrOAuthFailed      = &Err{Message: "failed to log in with this provider", Status: http.StatusUnauthorized}
+	ErrIdentityLinked   = &Err{Message: "this external account has already been linked to another user", Status: http.StatusConflict}
+	ErrAccountExists    = &Err{Message: "an account with this email address already exists, please log in and link it first", Status: http.StatusConflict}
+
+	ErrPasswordNotExpired = &Err{Message: "your password has not expired, please change it after logging in", Status: http.StatusForbidden}
+	ErrLastLoginMethod    = &Err{Message: "this is your only way to log in, please set a password first", Status: http.StatusConflict}
+)
+
+var (
+	ErrRoleNotFound   = &Err{Message: "this role does not exist", Status: http.StatusNotFound}
+	ErrReasonRequired = &Err{Message: "please provide a reason"}
 )
 
 var (
-	ErrInvalidAuthHeader = &Err{Message: "your auth header is invalid"}
-	ErrUnauthenticated   = &Err{Message: "please login"}
-	ErrUnauthorized      = &Err{Message: "you are not authorized"}
+	ErrInvalidImage = &Err{Message: "image must be a jpg or png file"}
 )
 
 var (
-	ErrInfoRequired     = &Err{Message: "please provide a valid email address or a cellphone number"}
-	ErrInvalidUsername  = &Err{Message: "your username is not valid"}
-	ErrInvalidPassword  = &Err{Message: "your password is not valid"}
-	ErrInvalidEmail     = &Err{Message: "your email address is not valid"}
-	ErrInvalidCellphone = &Err{Message: "your cellphone number is not valid"}
-	ErrUserNotFound     = &Err{Message: "this account does not exist"}
-	ErrUserInactive     = &Err{Message: "please activate your account first"}
-	ErrUserRestricted   = &Err{Message: "this account has been restricted"}
-	ErrUserBanned       = &Err{Message: "this account has been banned"}
-	ErrWrongPassword    = &Err{Message: "incorrect password"}
-	ErrEncodingPassword = &Err{Message: "failed to encode your password"}
-	ErrEmailUsed        = &Err{Message: "this email address has already been used"}
-	ErrCellphoneUsed    = &Err{Message: "this cellphone number has already been used"}
-	ErrUserLogin        = &Err{Message: "you have logged in"}
-	ErrUserLogout       = &Err{Message: "you have logged out"}
+	ErrClientNotFound     = &Err{Message: "this app does not exist", Status: http.StatusNotFound}
+	ErrInvalidRedirectURI = &Err{Message: "this redirect uri is not registered for the app"}
+	ErrInvalidScope       = &Err{Message: "the app is not allowed to request this scope"}
+	ErrPKCERequired       = &Err{Message: "a code challenge by S256 is required"}
 )
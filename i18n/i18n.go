@@ -0,0 +1,133 @@
+// Package i18n translates messages shown to users.
+// Messages of each language are loaded from a yaml file named after the language, e.g. zh-CN.yaml,
+// which maps error codes to messages.
+package i18n
+
+import (
+	. "github.com/go-pandora/core/conf"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// bundles maps a language to its messages.
+var bundles = map[string]map[string]string{}
+
+func init() {
+	if err := Load(Config.LocalePath); err != nil {
+		log.Panicln("failed to load locales:" + err.Error())
+	}
+}
+
+// Load loads all message bundles in dir.
+func Load(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		messages := make(map[string]string)
+		if err = yaml.Unmarshal(data, &messages); err != nil {
+			return err
+		}
+		bundles[strings.TrimSuffix(filepath.Base(file), ".yaml")] = messages
+	}
+	return nil
+}
+
+// Translate returns message of code in language.
+// If language or code is unknown, messages of default language or fallback will be used.
+func Translate(lang string, code int, fallback string) string {
+	key := strconv.Itoa(code)
+	for _, l := range []string{Match(lang), Config.DefaultLanguage} {
+		if message, ok := bundles[l][key]; ok {
+			return message
+		}
+	}
+	return fallback
+}
+
+// Negotiate chooses a supported language.
+// Language preferred by user comes first, then languages in Accept-Language header in order of quality,
+// and default language is used if none of them is supported.
+func Negotiate(preferred string, acceptLanguage string) string {
+	if lang := Match(preferred); lang != "" {
+		return lang
+	}
+	for _, tag := range parseAcceptLanguage(acceptLanguage) {
+		if lang := Match(tag); lang != "" {
+			return lang
+		}
+	}
+	return Config.DefaultLanguage
+}
+
+// Match finds a supported language of tag, an empty string is returned if there is none.
+// Tag is compared case-insensitively, and only its primary language is compared if there is no exact match,
+// so that both "zh" and "zh-Hans" match "zh-CN".
+func Match(tag string) string {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return ""
+	}
+	langs := make([]string, 0, len(bundles))
+	for lang := range bundles {
+		if strings.EqualFold(lang, tag) {
+			return lang
+		}
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	primary := strings.SplitN(tag, "-", 2)[0]
+	for _, lang := range langs {
+		if strings.EqualFold(strings.SplitN(lang, "-", 2)[0], primary) {
+			return lang
+		}
+	}
+	return ""
+}
+
+// parseAcceptLanguage returns language tags in Accept-Language header in order of quality.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+
+	result := make([]string, len(tags))
+	for i, t := range tags {
+		result[i] = t.tag
+	}
+	return result
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/middleware/jwt"
+	"github.com/go-pandora/core/models"
 	"github.com/go-pandora/core/routers"
 	"log"
 	"net/http"
@@ -22,6 +24,24 @@ func main() {
 		MaxHeaderBytes: 1 << 20,
 	}
 
+	// Restrictions and bans with expiry are lifted in background.
+	go func() {
+		for range time.Tick(time.Minute) {
+			if err := models.LiftExpiredModerations(); err != nil {
+				log.Println(err)
+			}
+		}
+	}()
+
+	// Keys rotated by other servers are loaded, and keys are rotated on schedule.
+	go func() {
+		for range time.Tick(time.Minute) {
+			if err := jwt.RefreshKeys(); err != nil {
+				log.Println(err)
+			}
+		}
+	}()
+
 	go func() {
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Panicf("Fail to start server: %s", err)
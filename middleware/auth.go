@@ -2,9 +2,8 @@ package middleware
 
 import (
 	"github.com/gin-gonic/gin"
-	"github.com/go-pandora/core/api"
 	"github.com/go-pandora/core/errs"
-	"net/http"
+	"github.com/go-pandora/core/models"
 	"strconv"
 )
 
@@ -16,11 +15,77 @@ func SimpleAuthorizer() gin.HandlerFunc {
 			userIdInt64, _ := strconv.ParseInt(userId, 10, 64)
 			id := c.GetInt64("id")
 			if userIdInt64 != id {
-				c.AbortWithStatusJSON(http.StatusForbidden, api.Response{
-					Message: errs.ErrUnauthorized.Error(),
-				})
+				abortWithError(c, errs.ErrUnauthorized)
 				return
 			}
 		}
 	}
 }
+
+// RequireOwner only permits user :id to access its private resources, whatever the method is.
+// It must be used after IdValidator and an authenticator.
+func RequireOwner() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authenticated(c) {
+			return
+		}
+		if c.GetString("user_id") != strconv.FormatInt(c.GetInt64("id"), 10) {
+			abortWithError(c, errs.ErrUnauthorized)
+		}
+	}
+}
+
+// RequireRole only permits users who have at least one of roles.
+// It must be used after an authenticator.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authenticated(c) {
+			return
+		}
+		for _, required := range roles {
+			if contains(c.GetStringSlice("roles"), required) {
+				return
+			}
+		}
+		abortWithError(c, errs.ErrUnauthorized)
+	}
+}
+
+// RequirePermission only permits users whose roles grant all of permissions.
+// It must be used after an authenticator.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authenticated(c) {
+			return
+		}
+		granted, err := models.GetRolePermissions(c.GetStringSlice("roles"))
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		for _, required := range permissions {
+			if !contains(granted, required) {
+				abortWithError(c, errs.ErrUnauthorized)
+				return
+			}
+		}
+	}
+}
+
+// authenticated aborts the request if user has not logged in.
+func authenticated(c *gin.Context) bool {
+	if c.GetString("user_id") == "" {
+		abortWithError(c, errs.ErrUnauthenticated)
+		return false
+	}
+	return true
+}
+
+func contains(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
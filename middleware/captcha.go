@@ -0,0 +1,15 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/core/api"
+)
+
+// RequireCaptcha requires a valid captcha, see api.GetCaptcha.
+func RequireCaptcha() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := api.CheckCaptcha(c); err != nil {
+			abortWithError(c, err)
+		}
+	}
+}
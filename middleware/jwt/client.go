@@ -0,0 +1,81 @@
+package jwt
+
+import (
+	"github.com/go-pandora/core/cache"
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/util/randutil"
+	"time"
+)
+
+// GenerateClientAccessJWT generates an access token for an OAuth app, which acts on behalf of user id,
+// or on its own if id is zero. App is the audience of token.
+func GenerateClientAccessJWT(id int64, clientId string, scope string) (string, error) {
+	return generateClientJWT(id, clientId, scope, Config.Timeout, accessKeys)
+}
+
+// GenerateClientRefreshJWT generates a refresh token for an OAuth app, which acts on behalf of user id.
+func GenerateClientRefreshJWT(id int64, clientId string, scope string) (string, error) {
+	return generateClientJWT(id, clientId, scope, Config.MaxRefreshTime, refreshKeys)
+}
+
+// Tokens issued to apps have ids, so that they can be revoked one by one.
+func generateClientJWT(id int64, clientId string, scope string, timeout time.Duration, keys *keyRing) (string, error) {
+	jti, err := randutil.Token(16)
+	if err != nil {
+		return "", err
+	}
+	claims := JWTClaims{Id: id, ClientId: clientId, Scope: scope}
+	claims.StandardClaims.Id = jti
+	claims.Audience = clientId
+	return generateJWT(claims, timeout, keys)
+}
+
+// ValidateClientAccessJWT validates an access token issued to an OAuth app.
+func ValidateClientAccessJWT(token string) (*JWTClaims, error) {
+	return validateClientJWT(token, accessKeys)
+}
+
+// ValidateClientRefreshJWT validates a refresh token issued to an OAuth app.
+func ValidateClientRefreshJWT(token string) (*JWTClaims, error) {
+	return validateClientJWT(token, refreshKeys)
+}
+
+func validateClientJWT(token string, keys *keyRing) (*JWTClaims, error) {
+	claims, err := validateJWT(token, keys)
+	if err != nil {
+		return nil, err
+	}
+	if claims.ClientId == "" {
+		return nil, errs.ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// RevokeClientToken revokes a single token issued to an OAuth app.
+func RevokeClientToken(claims *JWTClaims) error {
+	return cache.RevokeToken(claims.StandardClaims.Id, time.Unix(claims.ExpiresAt, 0))
+}
+
+// ConsumeClientToken revokes a refresh token issued to an OAuth app once it is used,
+// false means it has just been used by another request.
+func ConsumeClientToken(claims *JWTClaims) (bool, error) {
+	return cache.ConsumeToken(claims.StandardClaims.Id, time.Unix(claims.ExpiresAt, 0))
+}
+
+// isClientJWTRevoked checks if a token issued to an app has been revoked by itself,
+// or along with all tokens of the app, or with those on behalf of the user.
+func isClientJWTRevoked(claims *JWTClaims) bool {
+	if claims.StandardClaims.Id == "" || cache.IsTokenRevoked(claims.StandardClaims.Id) {
+		return true
+	}
+	if _, revoked := cache.IsJWTRevoked(cache.ClientJWTKey(claims.ClientId, 0), claims.issuedAt()); revoked {
+		return true
+	}
+	if claims.Id != 0 {
+		if _, revoked := cache.IsJWTRevoked(cache.ClientJWTKey(claims.ClientId, claims.Id), claims.issuedAt()); revoked {
+			return true
+		}
+	}
+	return false
+}
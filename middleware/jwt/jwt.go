@@ -1,91 +1,164 @@
+// Package jwt provides JWT-based authentication.
 package jwt
 
 import (
-	"fmt"
-	. "github.com/Fallensouls/Pandora/conf"
-	"github.com/Fallensouls/Pandora/errs"
 	"github.com/dgrijalva/jwt-go"
+	"github.com/go-pandora/core/cache"
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/util/randutil"
+	"log"
+	"strconv"
 	"time"
 )
 
 type JWTClaims struct {
 	jwt.StandardClaims
-	Id int64 `json:"id"`
+	Id    int64    `json:"id"`
+	Roles []string `json:"roles,omitempty"`
+	// Tokens issued to OAuth apps carry client id and scope, user id is zero if app acts on its own.
+	ClientId string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	// Refresh tokens issued since the same login belong to a family, each of them can only be used once.
+	Family string `json:"fam,omitempty"`
+	// IssuedAtMilli tells whether a token is issued before a revocation in the same second, which iat can't.
+	IssuedAtMilli int64 `json:"iat_ms,omitempty"`
 }
 
-var (
-	accessSecret  = []byte(Config.AccessSecret)
-	refreshSecret = []byte(Config.RefreshSecret)
-)
+// issuedAt returns when claims are issued in milliseconds,
+// tokens issued by earlier versions are regarded as issued at the beginning of iat.
+func (c *JWTClaims) issuedAt() int64 {
+	if c.IssuedAtMilli != 0 {
+		return c.IssuedAtMilli
+	}
+	return c.IssuedAt * 1000
+}
 
 // generateJWT generates Json Web Token used for authentication.
-// Here we use user's id as extra data.
+// Here we use user's id and roles as extra data.
 // Please do not add important information such as password to payload of JWT.
-func generateJWT(id int64, timeout time.Duration, secret []byte) (token string, err error) {
-	claim := JWTClaims{
-		Id: id,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(timeout).Unix(),
-			Issuer:    Config.Issuer,
-			IssuedAt:  time.Now().Unix(),
-		},
-	}
+func generateJWT(claim JWTClaims, timeout time.Duration, keys *keyRing) (token string, err error) {
+	now := time.Now()
+	claim.ExpiresAt = now.Add(timeout).Unix()
+	claim.Issuer = Config.Issuer
+	claim.IssuedAt, claim.IssuedAtMilli = now.Unix(), now.UnixMilli()
 
-	unsigned := jwt.NewWithClaims(getSigningMethod(Config.SigningAlgorithm), claim)
-	token, err = unsigned.SignedString(secret)
+	key := keys.signingKey()
+	unsigned := jwt.NewWithClaims(key.method, claim)
+	if key.id != "" {
+		unsigned.Header["kid"] = key.id
+	}
+	token, err = unsigned.SignedString(key.sign)
 	return
 }
 
-func GenerateAccessJWT(id int64) (string, error) {
-	return generateJWT(id, Config.Timeout, accessSecret)
+// GenerateAccessJWT generates an access token which carries user's roles.
+func GenerateAccessJWT(id int64, roles []string) (string, error) {
+	return generateJWT(JWTClaims{Id: id, Roles: roles}, Config.Timeout, accessKeys)
 }
 
+// GenerateRefreshJWT generates a refresh token, which begins a new family.
+// Roles are not carried, they will be loaded again when refreshing.
 func GenerateRefreshJWT(id int64) (string, error) {
-	return generateJWT(id, Config.MaxRefreshTime, refreshSecret)
+	family, err := randutil.Token(16)
+	if err != nil {
+		return "", err
+	}
+	claims, err := newRefreshClaims(id, family)
+	if err != nil {
+		return "", err
+	}
+	token, err := generateJWT(*claims, Config.MaxRefreshTime, refreshKeys)
+	if err != nil {
+		return "", err
+	}
+	if err = cache.StartRefreshFamily(family, claims.StandardClaims.Id, Config.MaxRefreshTime); err != nil {
+		return "", err
+	}
+	return token, nil
 }
 
-// validateJWT validates whether jwt is valid.
-// If so, we still have to check if user really logged in before.
-func validateJWT(tokenString string, secret []byte) (int64, int64, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Don't forget to validation the alg is what you expect:
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return secret, nil
-	})
+// RotateRefreshJWT replaces a used refresh token by the next one of its family,
+// which expires at the same time, so that a login still lasts no longer than MaxRefreshTime.
+// If the token had been used before, it has been stolen or replayed, the whole family is revoked.
+func RotateRefreshJWT(claims *JWTClaims) (string, error) {
+	if claims.Family == "" || claims.StandardClaims.Id == "" {
+		return "", errs.ErrInvalidToken
+	}
+	next, err := newRefreshClaims(claims.Id, claims.Family)
+	if err != nil {
+		return "", errs.New(err)
+	}
+	token, err := generateJWT(*next, time.Until(time.Unix(claims.ExpiresAt, 0)), refreshKeys)
+	if err != nil {
+		return "", errs.New(err)
+	}
+	result, err := cache.RotateRefreshFamily(claims.Family, claims.StandardClaims.Id, next.StandardClaims.Id)
+	if err != nil {
+		return "", err
+	}
+	switch result {
+	case cache.RefreshRotated:
+		return token, nil
+	case cache.RefreshReused:
+		log.Printf("refresh token %s of user %d is reused, family %s is revoked",
+			claims.StandardClaims.Id, claims.Id, claims.Family)
+	}
+	return "", errs.ErrInvalidToken
+}
 
-	claims := token.Claims.(jwt.MapClaims)
-	if claims["id"] == nil || err != nil {
-		return 0, 0, errs.ErrInvalidToken
+func newRefreshClaims(id int64, family string) (*JWTClaims, error) {
+	jti, err := randutil.Token(16)
+	if err != nil {
+		return nil, err
 	}
+	claims := &JWTClaims{Id: id, Family: family}
+	claims.StandardClaims.Id = jti
+	return claims, nil
+}
 
-	id, ok := claims["id"].(float64)
-	if !ok {
-		return 0, 0, errs.ErrInvalidToken
+// validateJWT validates whether jwt is valid.
+// If so, we still have to check if user's jwt has been revoked.
+func validateJWT(tokenString string, keys *keyRing) (*JWTClaims, error) {
+	claims := new(JWTClaims)
+	token, err := jwt.ParseWithClaims(tokenString, claims, keys.verifyKey)
+	if err != nil || !token.Valid || (claims.Id == 0 && claims.ClientId == "") {
+		return nil, errs.ErrInvalidToken
 	}
 
-	iat := claims["iat"].(float64)
-	return int64(id), int64(iat), nil
+	if claims.Id != 0 {
+		if _, revoked := cache.IsJWTRevoked(strconv.FormatInt(claims.Id, 10), claims.issuedAt()); revoked {
+			return nil, errs.ErrInvalidToken
+		}
+	}
+	if claims.ClientId != "" && isClientJWTRevoked(claims) {
+		return nil, errs.ErrInvalidToken
+	}
+	return claims, nil
 }
 
-func ValidateAccessJWT(token string) (int64, int64, error) {
-	return validateJWT(token, accessSecret)
+// ValidateAccessJWT validates an access token of Pandora itself, tokens issued to OAuth apps are not accepted.
+func ValidateAccessJWT(token string) (*JWTClaims, error) {
+	return validateUserJWT(token, accessKeys)
 }
 
-func ValidateRefreshJWT(token string) (int64, int64, error) {
-	return validateJWT(token, refreshSecret)
+// ValidateRefreshJWT validates a refresh token of Pandora itself, tokens issued to OAuth apps are not accepted.
+func ValidateRefreshJWT(token string) (*JWTClaims, error) {
+	return validateUserJWT(token, refreshKeys)
 }
 
-func getSigningMethod(method string) *jwt.SigningMethodHMAC {
-	switch method {
-	case "HS256":
-		return jwt.SigningMethodHS256
-	case "HS384":
-		return jwt.SigningMethodHS384
-	case "HS512":
-		return jwt.SigningMethodHS512
-	default:
-		return jwt.SigningMethodHS256
+func validateUserJWT(token string, keys *keyRing) (*JWTClaims, error) {
+	claims, err := validateJWT(token, keys)
+	if err != nil {
+		return nil, err
 	}
+	if claims.ClientId != "" {
+		return nil, errs.ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// Revoke revokes all jwt issued to user before now.
+func Revoke(id int64) error {
+	return cache.RevokeJWT(strconv.FormatInt(id, 10))
 }
@@ -0,0 +1,289 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-pandora/core/cache"
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/models"
+	"github.com/go-pandora/core/util/cryptoutil"
+	"github.com/go-pandora/core/util/jwk"
+	"github.com/go-pandora/core/util/randutil"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// signingKey signs tokens and verifies them.
+type signingKey struct {
+	method  jwt.SigningMethod
+	id      string      // kid in header of tokens
+	sign    interface{} // HMAC secret or private key
+	verify  interface{} // HMAC secret or public key
+	public  *jwk.Key    // published by JWKS, nil for HMAC secrets
+	created time.Time
+}
+
+// keyRing holds keys of one kind, so that an access token can never be used as a refresh token and vice versa.
+// The newest key signs new tokens, and all keys which have not retired verify tokens by kid.
+// Keys are stored in database and shared by all servers.
+type keyRing struct {
+	kind     string
+	lifetime time.Duration // how long tokens signed by a key live
+	legacy   string        // kid of the configured HMAC secret, which verifies tokens issued without kid
+
+	mu     sync.RWMutex
+	keys   map[string]*signingKey
+	signer *signingKey
+	loaded time.Time
+}
+
+// reloadInterval limits how often keys are loaded again for an unknown kid, which may be added by another server.
+const reloadInterval = 10 * time.Second
+
+var (
+	accessKeys  = newKeyRing(models.KeyAccess, Config.Timeout, Config.AccessSecret, Config.AccessKeyFile)
+	refreshKeys = newKeyRing(models.KeyRefresh, Config.MaxRefreshTime, Config.RefreshSecret, Config.RefreshKeyFile)
+)
+
+// newKeyRing loads keys of kind. A key in configuration which has never been added becomes the signing key,
+// so that replacing it in configuration also rotates keys.
+func newKeyRing(kind string, lifetime time.Duration, secret string, file string) *keyRing {
+	r := &keyRing{kind: kind, lifetime: lifetime}
+	configured, err := configuredKey(kind, secret, file)
+	if err != nil {
+		log.Panicf("failed to load %s key of jwt: %s", kind, err)
+	}
+	exist, err := models.SigningKeyExists(kind, configured.Kid)
+	if err != nil {
+		log.Panicf("failed to load %s key of jwt: %s", kind, err)
+	}
+	if !exist {
+		if err = configured.AddSigningKey(lifetime); err != nil {
+			log.Panicf("failed to add %s key of jwt: %s", kind, err)
+		}
+	}
+	if isHMAC(configured.Algorithm) {
+		r.legacy = configured.Kid
+	}
+	if err = r.reload(); err != nil {
+		log.Panicf("failed to load %s keys of jwt: %s", kind, err)
+	}
+	return r
+}
+
+// configuredKey reads the key in configuration, which is a secret for HMAC algorithms,
+// or a PEM file of private key for asymmetric ones.
+func configuredKey(kind string, secret string, file string) (*models.SigningKey, error) {
+	algorithm := signingAlgorithm()
+	key := &models.SigningKey{Kind: kind, Algorithm: algorithm}
+	if isHMAC(algorithm) {
+		return sealMaterial(key, []byte(secret), jwk.SecretThumbprint([]byte(secret)))
+	}
+	if file == "" {
+		return nil, fmt.Errorf("a pem key file is required by signing algorithm %s", algorithm)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := jwk.ParsePEM(data, algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return sealMaterial(key, data, parsed.ID)
+}
+
+// newSigningKey generates a key of kind for the configured algorithm.
+func newSigningKey(kind string) (*models.SigningKey, error) {
+	algorithm := signingAlgorithm()
+	key := &models.SigningKey{Kind: kind, Algorithm: algorithm}
+	if isHMAC(algorithm) {
+		secret, err := randutil.Bytes(32)
+		if err != nil {
+			return nil, err
+		}
+		return sealMaterial(key, secret, jwk.SecretThumbprint(secret))
+	}
+	generated, err := jwk.Generate(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	data, err := generated.PEM()
+	if err != nil {
+		return nil, err
+	}
+	return sealMaterial(key, data, generated.ID)
+}
+
+// sealMaterial encrypts material of key by KeyEncryptionKey, so that a leaked database doesn't leak signing keys.
+func sealMaterial(key *models.SigningKey, material []byte, kid string) (*models.SigningKey, error) {
+	sealed, err := cryptoutil.Seal(Config.KeyEncryptionKey, material)
+	if err != nil {
+		return nil, err
+	}
+	key.Material, key.Kid = sealed, kid
+	return key, nil
+}
+
+func parseSigningKey(key *models.SigningKey) (*signingKey, error) {
+	method := jwt.GetSigningMethod(key.Algorithm)
+	if method == nil {
+		return nil, fmt.Errorf("unknown signing algorithm %s", key.Algorithm)
+	}
+	material, err := cryptoutil.Open(Config.KeyEncryptionKey, key.Material)
+	if err != nil {
+		return nil, err
+	}
+	parsed := &signingKey{method: method, id: key.Kid, created: time.Time(key.CreateAt)}
+	if isHMAC(key.Algorithm) {
+		parsed.sign, parsed.verify = material, material
+		return parsed, nil
+	}
+	private, err := jwk.ParsePEM(material, key.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	parsed.sign, parsed.verify, parsed.public = private.Private, private.Public(), private
+	return parsed, nil
+}
+
+// reload loads keys which have not retired from database.
+func (r *keyRing) reload() error {
+	rows, err := models.GetActiveSigningKeys(r.kind)
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]*signingKey)
+	var signer *signingKey
+	for i := range rows {
+		key, err := parseSigningKey(&rows[i])
+		if err != nil {
+			log.Printf("failed to load %s key %s of jwt: %s", r.kind, rows[i].Kid, err)
+			continue
+		}
+		keys[key.id] = key
+		signer = key
+	}
+	if signer == nil {
+		return errors.New("no signing key is available")
+	}
+
+	r.mu.Lock()
+	r.keys, r.signer, r.loaded = keys, signer, time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+// rotate makes a new key sign tokens, the previous one retires after tokens signed by it have expired.
+func (r *keyRing) rotate() error {
+	key, err := newSigningKey(r.kind)
+	if err != nil {
+		return err
+	}
+	if err = key.AddSigningKey(r.lifetime); err != nil {
+		return err
+	}
+	return r.reload()
+}
+
+func (r *keyRing) signingKey() *signingKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.signer
+}
+
+// lookup finds a key by kid, keys are loaded again if kid is unknown.
+func (r *keyRing) lookup(kid string) *signingKey {
+	r.mu.RLock()
+	key, loaded := r.keys[kid], r.loaded
+	r.mu.RUnlock()
+	if key != nil || time.Since(loaded) < reloadInterval {
+		return key
+	}
+	if err := r.reload(); err != nil {
+		log.Printf("failed to reload %s keys of jwt: %s", r.kind, err)
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.keys[kid]
+}
+
+// verifyKey returns the key which verifies token.
+// Algorithm in header must be exactly the one of key, otherwise a public key may be misused as an HMAC secret.
+func (r *keyRing) verifyKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = r.legacy
+	}
+	key := r.lookup(kid)
+	if key == nil {
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.verify, nil
+}
+
+// RotateKeys makes new keys sign access tokens and refresh tokens.
+// Tokens signed by previous keys stay valid until they expire.
+func RotateKeys() error {
+	if err := accessKeys.rotate(); err != nil {
+		return err
+	}
+	return refreshKeys.rotate()
+}
+
+// RefreshKeys loads keys which have been rotated by other servers or have retired,
+// and rotates keys if they are older than KeyRotationInterval.
+func RefreshKeys() error {
+	if err := accessKeys.reload(); err != nil {
+		return err
+	}
+	if err := refreshKeys.reload(); err != nil {
+		return err
+	}
+	if Config.KeyRotationInterval <= 0 || time.Since(accessKeys.signingKey().created) < Config.KeyRotationInterval {
+		return nil
+	}
+	if locked, err := cache.LockKeyRotation(time.Minute); err != nil || !locked {
+		return err
+	}
+	return RotateKeys()
+}
+
+// JWKS returns public keys which verify access tokens, it is empty if tokens are signed by HMAC.
+func JWKS() jwk.Set {
+	accessKeys.mu.RLock()
+	defer accessKeys.mu.RUnlock()
+	set := jwk.Set{Keys: []jwk.JSONWebKey{}}
+	for _, key := range accessKeys.keys {
+		if key.public != nil {
+			set.Keys = append(set.Keys, key.public.JWK())
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+// signingAlgorithm returns the configured algorithm, HS256 by default.
+func signingAlgorithm() string {
+	switch Config.SigningAlgorithm {
+	case "":
+		return jwt.SigningMethodHS256.Alg()
+	case "HS256", "HS384", "HS512", "RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA":
+		return Config.SigningAlgorithm
+	default:
+		log.Panicf("unknown jwt signing algorithm: %s", Config.SigningAlgorithm)
+		return ""
+	}
+}
+
+func isHMAC(algorithm string) bool {
+	return strings.HasPrefix(algorithm, "HS")
+}
@@ -0,0 +1,48 @@
+package jwt
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/core/errs"
+	"strconv"
+	"strings"
+)
+
+// Authenticator checks whether user is authenticated by an access token.
+// GET requests are not required to be authenticated,
+// but user_id and roles will still be set if the token is valid.
+func Authenticator() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := BearerToken(c)
+		if !ok {
+			if c.Request.Method != "GET" {
+				c.Set("error", errs.ErrUnauthenticated)
+				c.Abort()
+			}
+			return
+		}
+
+		claims, err := ValidateAccessJWT(token)
+		if err != nil {
+			if c.Request.Method != "GET" {
+				c.Set("error", err)
+				c.Abort()
+			}
+			return
+		}
+		c.Set("user_id", strconv.FormatInt(claims.Id, 10))
+		c.Set("roles", claims.Roles)
+	}
+}
+
+// BearerToken extracts token from Authorization header.
+func BearerToken(c *gin.Context) (string, bool) {
+	auth := c.Request.Header.Get("Authorization")
+	if auth == "" {
+		return "", false
+	}
+	parts := strings.SplitN(auth, " ", 2)
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return "", false
+	}
+	return parts[1], true
+}
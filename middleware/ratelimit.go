@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/middleware/ratelimit"
+	"log"
+)
+
+var rateLimitStore ratelimit.Store
+
+func init() {
+	if Config.RateLimitStore == "memory" {
+		rateLimitStore = ratelimit.NewMemoryStore()
+	} else {
+		rateLimitStore = ratelimit.RedisStore{}
+	}
+}
+
+// SetRateLimitStore replaces the store of all rate limits.
+func SetRateLimitStore(store ratelimit.Store) {
+	rateLimitStore = store
+}
+
+// RateLimit limits requests by the configured rule of name.
+// Limit and remaining requests are told by X-RateLimit-* headers,
+// and requests beyond the limit are rejected with a Retry-After header.
+func RateLimit(name string) gin.HandlerFunc {
+	rule, ok := Config.RateLimitRules[name]
+	if !ok {
+		log.Panicf("rate limit rule %s is not configured", name)
+	}
+	return func(c *gin.Context) {
+		result, err := rateLimitStore.Take(rateLimitKey(c, name, rule), rule)
+		if err != nil {
+			// Rate limit only protects from abuse, so requests are let through if the store fails.
+			log.Printf("failed to check rate limit %s: %s", name, err)
+			return
+		}
+
+		ratelimit.SetHeaders(c.Writer.Header(), rule.Limit, result)
+		if !result.Allowed {
+			abortWithError(c, errs.ErrTooManyRequests)
+		}
+	}
+}
+
+// rateLimitKey tells whose requests are counted together.
+// Requests of anonymous users are counted by IP when rule is keyed by user.
+func rateLimitKey(c *gin.Context, name string, rule *RateLimitRule) string {
+	switch rule.Key {
+	case LimitByUser:
+		if uid := c.GetString("user_id"); uid != "" {
+			return name + ":user:" + uid
+		}
+	case LimitByRoute:
+		return name + ":route"
+	}
+	return name + ":ip:" + c.ClientIP()
+}
@@ -0,0 +1,145 @@
+// Package ratelimit keeps states of rate limits, in Redis to be shared by all nodes, or in memory.
+package ratelimit
+
+import (
+	"github.com/go-pandora/core/cache"
+	. "github.com/go-pandora/core/conf"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Store keeps states of rate limits.
+type Store interface {
+	// Take counts a request of key, and tells whether it is allowed by rule.
+	Take(key string, rule *RateLimitRule) (cache.RateLimitResult, error)
+}
+
+// SetHeaders tells limit and remaining requests by X-RateLimit-* headers,
+// and when to retry by a Retry-After header if request is denied.
+func SetHeaders(h http.Header, limit int, result cache.RateLimitResult) {
+	h.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	h.Set("X-RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+	if !result.Allowed {
+		h.Set("Retry-After", strconv.Itoa(seconds(result.RetryAfter)))
+	}
+}
+
+func seconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
+
+// RedisStore keeps rate limits in Redis, so that they are shared by all nodes.
+type RedisStore struct{}
+
+func (RedisStore) Take(key string, rule *RateLimitRule) (cache.RateLimitResult, error) {
+	if rule.Algorithm == AlgorithmTokenBucket {
+		return cache.TakeTokenBucket(key, rule.Limit, rule.Window)
+	}
+	return cache.TakeSlidingWindow(key, rule.Limit, rule.Window)
+}
+
+// MemoryStore keeps rate limits in memory, which suits a single node or tests.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	windows map[string]*window
+	swept   time.Time
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	window time.Duration
+}
+
+type window struct {
+	requests []time.Time
+	window   time.Duration
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+		windows: make(map[string]*window),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Take(key string, rule *RateLimitRule) (cache.RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+	if rule.Algorithm == AlgorithmTokenBucket {
+		return s.takeToken(key, rule, now), nil
+	}
+	return s.takeWindow(key, rule, now), nil
+}
+
+func (s *MemoryStore) takeToken(key string, rule *RateLimitRule, now time.Time) cache.RateLimitResult {
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rule.Limit), last: now, window: rule.Window}
+		s.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(float64(rule.Limit), b.tokens+float64(elapsed)*float64(rule.Limit)/float64(rule.Window))
+	}
+	b.last = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return cache.TokenBucket(allowed, b.tokens, rule.Limit, rule.Window)
+}
+
+func (s *MemoryStore) takeWindow(key string, rule *RateLimitRule, now time.Time) cache.RateLimitResult {
+	w, ok := s.windows[key]
+	if !ok {
+		w = &window{window: rule.Window}
+		s.windows[key] = w
+	}
+	requests := w.requests
+	start := 0
+	for start < len(requests) && !requests[start].After(now.Add(-rule.Window)) {
+		start++
+	}
+	requests = requests[start:]
+
+	allowed := len(requests) < rule.Limit
+	if allowed {
+		requests = append(requests, now)
+	}
+	w.requests = requests
+	return cache.SlidingWindow(allowed, len(requests), requests[0], requests[len(requests)-1],
+		rule.Limit, rule.Window, now)
+}
+
+// sweep forgets idle keys once in a while, so that memory won't grow with every client ever seen.
+// A key is idle if nothing happens in its window, when its bucket must be full and its window must be empty.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.swept) < time.Minute {
+		return
+	}
+	s.swept = now
+	for key, b := range s.buckets {
+		if now.Sub(b.last) > b.window {
+			delete(s.buckets, key)
+		}
+	}
+	for key, w := range s.windows {
+		if len(w.requests) == 0 || now.Sub(w.requests[len(w.requests)-1]) > w.window {
+			delete(s.windows, key)
+		}
+	}
+}
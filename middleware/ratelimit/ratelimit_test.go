@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"github.com/go-pandora/core/cache"
+	. "github.com/go-pandora/core/conf"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type rateLimitStep struct {
+	at         time.Duration // since the first request
+	allowed    bool
+	remaining  int
+	retryAfter time.Duration
+}
+
+func runRateLimitSteps(t *testing.T, rule *RateLimitRule, steps []rateLimitStep) {
+	start := time.Unix(1000000, 0)
+	var now time.Time
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	for i, step := range steps {
+		now = start.Add(step.at)
+		result, err := store.Take("key", rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, step.allowed, result.Allowed, "step %d", i)
+		assert.Equal(t, step.remaining, result.Remaining, "step %d", i)
+		assert.Equal(t, step.retryAfter, result.RetryAfter, "step %d", i)
+	}
+}
+
+func TestMemoryStore_TokenBucket(t *testing.T) {
+	// 3 tokens, refilled at one token per second.
+	rule := &RateLimitRule{Algorithm: AlgorithmTokenBucket, Limit: 3, Window: 3 * time.Second}
+	runRateLimitSteps(t, rule, []rateLimitStep{
+		{at: 0, allowed: true, remaining: 2},
+		{at: 0, allowed: true, remaining: 1},
+		{at: 0, allowed: true, remaining: 0},
+		{at: 0, allowed: false, remaining: 0, retryAfter: time.Second},
+		{at: 500 * time.Millisecond, allowed: false, remaining: 0, retryAfter: 500 * time.Millisecond},
+		{at: time.Second, allowed: true, remaining: 0},
+		{at: 10 * time.Second, allowed: true, remaining: 2}, // bucket never holds more than limit
+	})
+}
+
+func TestMemoryStore_SlidingWindow(t *testing.T) {
+	rule := &RateLimitRule{Algorithm: AlgorithmSlidingWindow, Limit: 2, Window: 10 * time.Second}
+	runRateLimitSteps(t, rule, []rateLimitStep{
+		{at: 0, allowed: true, remaining: 1},
+		{at: time.Second, allowed: true, remaining: 0},
+		{at: 2 * time.Second, allowed: false, remaining: 0, retryAfter: 8 * time.Second},
+		{at: 10 * time.Second, allowed: true, remaining: 0}, // the first request has left the window
+		{at: 11 * time.Second, allowed: true, remaining: 0},
+		{at: 12 * time.Second, allowed: false, remaining: 0, retryAfter: 8 * time.Second},
+	})
+}
+
+func TestMemoryStore_KeysAndRulesAreSeparate(t *testing.T) {
+	store := NewMemoryStore()
+	rule := &RateLimitRule{Algorithm: AlgorithmSlidingWindow, Limit: 1, Window: time.Minute}
+	bucket := &RateLimitRule{Algorithm: AlgorithmTokenBucket, Limit: 1, Window: time.Minute}
+
+	for _, key := range []string{"a", "b"} {
+		result, _ := store.Take(key, rule)
+		assert.True(t, result.Allowed, key)
+	}
+	result, _ := store.Take("a", rule)
+	assert.False(t, result.Allowed)
+	result, _ = store.Take("a", bucket)
+	assert.True(t, result.Allowed)
+}
+
+func TestSetHeaders(t *testing.T) {
+	h := http.Header{}
+	SetHeaders(h, 10, cache.RateLimitResult{Allowed: true, Remaining: 9, Reset: 1500 * time.Millisecond})
+	assert.Equal(t, "10", h.Get("X-RateLimit-Limit"))
+	assert.Equal(t, "9", h.Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "2", h.Get("X-RateLimit-Reset")) // seconds are rounded up
+	assert.Empty(t, h.Get("Retry-After"))
+
+	h = http.Header{}
+	SetHeaders(h, 10, cache.RateLimitResult{Remaining: 0, Reset: time.Minute, RetryAfter: 200 * time.Millisecond})
+	assert.Equal(t, "0", h.Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "60", h.Get("X-RateLimit-Reset"))
+	assert.Equal(t, "1", h.Get("Retry-After"))
+}
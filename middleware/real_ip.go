@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	. "github.com/go-pandora/core/conf"
+	"log"
+	"net"
+	"strings"
+)
+
+// RealIP replaces remote address of a request forwarded by trusted proxies with the address of client,
+// so that ClientIP of gin can't be forged by clients who send X-Forwarded-For themselves.
+// It only works if ForwardedByClientIP of gin is turned off.
+func RealIP() gin.HandlerFunc {
+	proxies := parseTrustedProxies(Config.TrustedProxies)
+	return func(c *gin.Context) {
+		host, port, err := net.SplitHostPort(c.Request.RemoteAddr)
+		if err != nil || !trustedProxy(proxies, host) {
+			return
+		}
+		// Each proxy appends the address it receives from, so the rightmost untrusted address is the client.
+		client := host
+		forwarded := strings.Split(c.GetHeader("X-Forwarded-For"), ",")
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(forwarded[i])
+			if net.ParseIP(ip) == nil {
+				break
+			}
+			client = ip
+			if !trustedProxy(proxies, ip) {
+				break
+			}
+		}
+		if client == host {
+			if ip := strings.TrimSpace(c.GetHeader("X-Real-Ip")); net.ParseIP(ip) != nil {
+				client = ip
+			}
+		}
+		c.Request.RemoteAddr = net.JoinHostPort(client, port)
+	}
+}
+
+func parseTrustedProxies(proxies []string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			log.Panicf("invalid trusted proxy %s: %s", proxy, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+func trustedProxy(proxies []*net.IPNet, host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/core/util/randutil"
+)
+
+const headerRequestId = "X-Request-ID"
+
+// RequestId assigns an id to each request, which is also returned in response header.
+// An id provided by client or proxy will be reused.
+func RequestId() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(headerRequestId)
+		if id == "" || len(id) > 64 {
+			id, _ = randutil.Token(16)
+		}
+		c.Set("request_id", id)
+		c.Header(headerRequestId, id)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/go-pandora/core/api"
 	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/i18n"
+	"github.com/go-pandora/core/models"
 	"log"
 	"net/http"
 	"strconv"
@@ -26,9 +28,7 @@ func IdValidator() gin.HandlerFunc {
 		if id, err = strconv.ParseInt(c.Param("id"), 10, 64); err != nil {
 			switch method {
 			case "GET", "PUT", "DELETE":
-				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-					"message": errs.ErrInvalidParam.Error(),
-				})
+				abortWithError(c, errs.ErrInvalidParam)
 			default:
 				break
 			}
@@ -39,21 +39,61 @@ func IdValidator() gin.HandlerFunc {
 }
 
 // ErrHandler checks whether there is an error after API is called.
-// If not, it will do nothing and just return
+// If not, it will do nothing and just return.
+// Otherwise, an error response with code, translated message, details and request id is returned.
+// Message of system errors is only logged.
 func ErrHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Next()
-		if err, ok := c.Get("error"); ok {
+		value, ok := c.Get("error")
+		if !ok || value == nil {
+			return
+		}
+		e, ok := value.(*errs.Err)
+		if !ok {
+			err, _ := value.(error)
 			if err == nil {
 				return
 			}
-			e := err.(*errs.Err)
-			if e.SystemError {
-				log.Println(e.Message)
-				c.Status(http.StatusInternalServerError)
-			} else {
-				c.JSON(http.StatusBadRequest, api.Response{Message: e.Message})
-			}
+			e = errs.New(err).(*errs.Err)
+		}
+
+		requestId := c.GetString("request_id")
+		if e.SystemError {
+			log.Printf("[%s] %s", requestId, e.Message)
+		}
+		lang := language(c)
+		message := i18n.Translate(lang, e.Code, e.Message)
+		if e.SystemError {
+			message = i18n.Translate(lang, e.Code, http.StatusText(http.StatusInternalServerError))
 		}
+		details := make([]errs.FieldError, len(e.Details))
+		for i, d := range e.Details {
+			details[i] = d
+			details[i].Message = i18n.Translate(lang, d.Code, d.Message)
+		}
+		c.AbortWithStatusJSON(e.Status, api.ErrorResponse{
+			Code:      e.Code,
+			Message:   message,
+			Details:   details,
+			RequestId: requestId,
+		})
+	}
+}
+
+// language negotiates the language of response.
+// Language in profile of an authenticated user is preferred to Accept-Language header.
+func language(c *gin.Context) string {
+	var preferred string
+	if userId := c.GetString("user_id"); userId != "" {
+		id, _ := strconv.ParseInt(userId, 10, 64)
+		preferred, _ = models.GetUserLanguage(id)
 	}
+	return i18n.Negotiate(preferred, c.GetHeader("Accept-Language"))
+}
+
+// abortWithError stops the handlers chain, and the error will be returned by ErrHandler.
+func abortWithError(c *gin.Context, err error) {
+	c.Set("error", err)
+	c.Abort()
 }
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/core/cache"
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"net/http"
+)
+
+// SessionAuthenticator checks whether user is authenticated by a session cookie.
+// Like JWT authenticator, GET requests are not required to be authenticated,
+// but user_id and roles will still be set if the session is valid.
+func SessionAuthenticator() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sid, err := c.Cookie(Config.CookieName)
+		if err != nil || sid == "" {
+			if c.Request.Method != "GET" {
+				abortWithError(c, errs.ErrUnauthenticated)
+			}
+			return
+		}
+
+		uid, roles, ok := cache.GetSession(sid)
+		if !ok {
+			ClearSessionCookie(c)
+			if c.Request.Method != "GET" {
+				abortWithError(c, errs.ErrUnauthenticated)
+			}
+			return
+		}
+		SetSessionCookie(c, sid)
+		c.Set("session_id", sid)
+		c.Set("user_id", uid)
+		c.Set("roles", roles)
+	}
+}
+
+// SetSessionCookie writes session id to a secure and HttpOnly cookie.
+// The cookie is refreshed on every request to keep up with the sliding expiration.
+func SetSessionCookie(c *gin.Context, sid string) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     Config.CookieName,
+		Value:    sid,
+		Path:     "/",
+		Domain:   Config.CookieDomain,
+		MaxAge:   int(Config.SessionTimeout.Seconds()),
+		Secure:   *Config.CookieSecure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ClearSessionCookie tells browser to delete the session cookie.
+func ClearSessionCookie(c *gin.Context) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     Config.CookieName,
+		Value:    "",
+		Path:     "/",
+		Domain:   Config.CookieDomain,
+		MaxAge:   -1,
+		Secure:   *Config.CookieSecure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,284 @@
+package models
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/util/randutil"
+	"net/url"
+	"strings"
+)
+
+// OAuthClient is an app which gets tokens from Pandora as an OAuth 2.0 authorization server.
+// A confidential client, e.g. a backend service, authenticates by its secret.
+// A public client, e.g. a mobile app or a single page app, can't keep a secret and relies on PKCE.
+type OAuthClient struct {
+	Id           int64    `json:"-"`
+	ClientId     string   `json:"client_id"     xorm:"unique notnull"`
+	SecretHash   string   `json:"-"`
+	Name         string   `json:"name"          xorm:"notnull"`
+	RedirectURIs []string `json:"redirect_uris" xorm:"'redirect_uris' json"`
+	Scopes       []string `json:"scopes"        xorm:"json"` // what the app may request
+	Confidential bool     `json:"confidential"  xorm:"notnull default false"`
+	CreateAt     JsonTime `json:"create_at"     xorm:"created"`
+}
+
+func (c *OAuthClient) TableName() string {
+	return "oauth_clients"
+}
+
+// OAuthConsent is what a user has allowed an app to access on his behalf.
+type OAuthConsent struct {
+	Id       int64
+	UserId   int64    `xorm:"unique(user_client) notnull"`
+	ClientId string   `xorm:"unique(user_client) notnull"`
+	Scope    string   // space separated like in OAuth requests
+	UpdateAt JsonTime `xorm:"updated"`
+}
+
+func (c *OAuthConsent) TableName() string {
+	return "oauth_consents"
+}
+
+// AuthorizedApp is an app which user has consented to.
+type AuthorizedApp struct {
+	ClientId string   `json:"client_id"`
+	Name     string   `json:"name"`
+	Scope    string   `json:"scope"`
+	UpdateAt JsonTime `json:"update_at"`
+}
+
+// AddClient registers an app, and returns its secret if it is confidential.
+// The secret is only stored as a hash, so it can't be shown again.
+func (c *OAuthClient) AddClient() (string, error) {
+	if strings.TrimSpace(c.Name) == "" {
+		return "", errs.ErrInvalidData
+	}
+	if len(c.RedirectURIs) == 0 {
+		return "", errs.ErrInvalidRedirectURI
+	}
+	for _, uri := range c.RedirectURIs {
+		if !validRedirectURI(uri) {
+			return "", errs.ErrInvalidRedirectURI
+		}
+	}
+	for _, scope := range c.Scopes {
+		if scope == "" || strings.ContainsAny(scope, " \"\\") {
+			return "", errs.ErrInvalidScope
+		}
+	}
+
+	id, err := randutil.Token(12)
+	if err != nil {
+		return "", errs.New(err)
+	}
+	c.ClientId = id
+	var secret string
+	if c.Confidential {
+		if secret, err = newClientSecret(); err != nil {
+			return "", errs.New(err)
+		}
+		c.SecretHash = hashClientSecret(secret)
+	}
+	if _, err = engine.Insert(c); err != nil {
+		return "", errs.New(err)
+	}
+	return secret, nil
+}
+
+// GetClient finds an app by client id.
+func GetClient(clientId string) (*OAuthClient, error) {
+	client := &OAuthClient{}
+	if exist, err := engine.Where("client_id = ?", clientId).Get(client); err != nil {
+		return nil, errs.New(err)
+	} else if !exist {
+		return nil, errs.ErrClientNotFound
+	}
+	return client, nil
+}
+
+// GetClients lists all registered apps.
+func GetClients() ([]OAuthClient, error) {
+	var clients []OAuthClient
+	if err := engine.Asc("id").Find(&clients); err != nil {
+		return nil, errs.New(err)
+	}
+	return clients, nil
+}
+
+// DeleteClient removes an app along with consents users have given to it.
+// Caller should revoke tokens which have been issued to the app.
+func DeleteClient(clientId string) error {
+	session := engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return errs.New(err)
+	}
+	if affected, err := session.Where("client_id = ?", clientId).Delete(&OAuthClient{}); err != nil {
+		session.Rollback()
+		return errs.New(err)
+	} else if affected == 0 {
+		session.Rollback()
+		return errs.ErrClientNotFound
+	}
+	if _, err := session.Where("client_id = ?", clientId).Delete(&OAuthConsent{}); err != nil {
+		session.Rollback()
+		return errs.New(err)
+	}
+	if err := session.Commit(); err != nil {
+		return errs.New(err)
+	}
+	return nil
+}
+
+// ResetClientSecret replaces secret of a confidential app, and returns the new one.
+func ResetClientSecret(clientId string) (string, error) {
+	secret, err := newClientSecret()
+	if err != nil {
+		return "", errs.New(err)
+	}
+	affected, err := engine.Where("client_id = ? AND confidential = ?", clientId, true).
+		Cols("secret_hash").Update(&OAuthClient{SecretHash: hashClientSecret(secret)})
+	if err != nil {
+		return "", errs.New(err)
+	} else if affected == 0 {
+		return "", errs.ErrClientNotFound
+	}
+	return secret, nil
+}
+
+// Authenticate checks secret of a confidential app.
+func (c *OAuthClient) Authenticate(secret string) bool {
+	if !c.Confidential || c.SecretHash == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashClientSecret(secret)), []byte(c.SecretHash)) == 1
+}
+
+// HasRedirectURI checks uri is exactly one of the registered redirect URIs.
+func (c *OAuthClient) HasRedirectURI(uri string) bool {
+	for _, registered := range c.RedirectURIs {
+		if uri == registered {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseScope checks an app is allowed to request scope, and returns it normalized.
+// Empty scope means all scopes of the app.
+func (c *OAuthClient) ParseScope(scope string) (string, error) {
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		return strings.Join(c.Scopes, " "), nil
+	}
+	for _, s := range requested {
+		if !containsScope(c.Scopes, s) {
+			return "", errs.ErrInvalidScope
+		}
+	}
+	return strings.Join(requested, " "), nil
+}
+
+// GetConsent returns scope which user has allowed an app to access, empty if he hasn't consented.
+func GetConsent(id int64, clientId string) (string, error) {
+	var consent OAuthConsent
+	if _, err := engine.Where("user_id = ? AND client_id = ?", id, clientId).Get(&consent); err != nil {
+		return "", errs.New(err)
+	}
+	return consent.Scope, nil
+}
+
+// GrantConsent records that user allows an app to access scope, in addition to what he has allowed before.
+func GrantConsent(id int64, clientId string, scope string) error {
+	consent := OAuthConsent{UserId: id, ClientId: clientId}
+	exist, err := engine.Where("user_id = ? AND client_id = ?", id, clientId).Get(&consent)
+	if err != nil {
+		return errs.New(err)
+	}
+	if !exist {
+		consent.Scope = scope
+		if _, err = engine.Insert(&consent); err != nil {
+			return errs.New(err)
+		}
+		return nil
+	}
+	if CoversScope(consent.Scope, scope) {
+		return nil
+	}
+	granted := strings.Fields(consent.Scope)
+	for _, s := range strings.Fields(scope) {
+		if !containsScope(granted, s) {
+			granted = append(granted, s)
+		}
+	}
+	consent.Scope = strings.Join(granted, " ")
+	if _, err = engine.ID(consent.Id).Cols("scope").Update(&consent); err != nil {
+		return errs.New(err)
+	}
+	return nil
+}
+
+// GetAuthorizedApps lists apps which user has consented to.
+func GetAuthorizedApps(id int64) ([]AuthorizedApp, error) {
+	var apps []AuthorizedApp
+	if err := engine.Table("oauth_consents").
+		Join("INNER", "oauth_clients", "oauth_clients.client_id = oauth_consents.client_id").
+		Select("oauth_consents.client_id, oauth_clients.name, oauth_consents.scope, oauth_consents.update_at").
+		Where("oauth_consents.user_id = ?", id).Asc("oauth_clients.name").Find(&apps); err != nil {
+		return nil, errs.New(err)
+	}
+	return apps, nil
+}
+
+// RevokeConsent takes back what user has allowed an app to access.
+// Caller should revoke tokens which have been issued to the app on behalf of user.
+func RevokeConsent(id int64, clientId string) error {
+	if _, err := engine.Where("user_id = ? AND client_id = ?", id, clientId).Delete(&OAuthConsent{}); err != nil {
+		return errs.New(err)
+	}
+	return nil
+}
+
+// CoversScope checks every scope requested is in granted, both are space separated.
+func CoversScope(granted string, requested string) bool {
+	scopes := strings.Fields(granted)
+	for _, s := range strings.Fields(requested) {
+		if !containsScope(scopes, s) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// validRedirectURI accepts absolute URIs without fragment, including custom schemes of native apps.
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Fragment != "" {
+		return false
+	}
+	if u.Scheme == "http" || u.Scheme == "https" {
+		return u.Host != ""
+	}
+	return true
+}
+
+func newClientSecret() (string, error) {
+	return randutil.Token(32)
+}
+
+// hashClientSecret hashes a secret by SHA-256, which is enough since secrets are random rather than chosen by people.
+func hashClientSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"github.com/go-pandora/core/errs"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestOAuthClient_ParseScope(t *testing.T) {
+	client := &OAuthClient{Scopes: []string{"profile", "email", "images"}}
+	tests := []struct {
+		scope    string
+		expected string
+		err      error
+	}{
+		{"", "profile email images", nil}, // all scopes of the app
+		{"  ", "profile email images", nil},
+		{"email", "email", nil},
+		{" profile   email ", "profile email", nil},
+		{"email admin", "", errs.ErrInvalidScope},
+		{"Email", "", errs.ErrInvalidScope},
+	}
+	for _, test := range tests {
+		scope, err := client.ParseScope(test.scope)
+		assert.Equal(t, test.err, err, test.scope)
+		assert.Equal(t, test.expected, scope, test.scope)
+	}
+}
+
+func TestCoversScope(t *testing.T) {
+	tests := []struct {
+		granted   string
+		requested string
+		expected  bool
+	}{
+		{"profile email", "email", true},
+		{"profile email", "email profile", true},
+		{"profile email", "", true},
+		{"profile", "profile email", false},
+		{"", "profile", false},
+		{"profile email", "prof", false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, CoversScope(test.granted, test.requested), test.granted+" / "+test.requested)
+	}
+}
+
+func TestGrantConsent(t *testing.T) {
+	requireDB(t)
+	var id int64 = -1
+	clientId := "test-consent-client"
+	defer RevokeConsent(id, clientId)
+
+	assert := assert.New(t)
+	scope, err := GetConsent(id, clientId)
+	assert.Nil(err)
+	assert.Equal("", scope)
+
+	assert.Nil(GrantConsent(id, clientId, "profile"))
+	scope, _ = GetConsent(id, clientId)
+	assert.Equal("profile", scope)
+
+	// scopes granted later are merged with those granted before.
+	assert.Nil(GrantConsent(id, clientId, "email profile"))
+	scope, _ = GetConsent(id, clientId)
+	assert.Equal("profile email", scope)
+	assert.Nil(GrantConsent(id, clientId, "email"))
+	scope, _ = GetConsent(id, clientId)
+	assert.Equal("profile email", scope)
+
+	assert.Nil(RevokeConsent(id, clientId))
+	scope, _ = GetConsent(id, clientId)
+	assert.Equal("", scope)
+}
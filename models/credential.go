@@ -0,0 +1,82 @@
+package models
+
+import (
+	"github.com/go-pandora/core/errs"
+	"strings"
+)
+
+// Credential is a WebAuthn public key credential (passkey) registered by a user.
+type Credential struct {
+	Id           int64    `json:"id"`
+	UserId       int64    `json:"-"             xorm:"index notnull"`
+	CredentialId string   `json:"credential_id" xorm:"unique notnull"` // base64url encoded
+	PublicKey    []byte   `json:"-"             xorm:"notnull"`        // COSE encoded
+	SignCount    int64    `json:"-"             xorm:"notnull"`
+	Name         string   `json:"name"`
+	CreateAt     JsonTime `json:"create_at"     xorm:"created"`
+	LastUsed     JsonTime `json:"last_used"`
+}
+
+func (c *Credential) TableName() string {
+	return "webauthn_credentials"
+}
+
+// AddCredential stores a credential registered by user.
+func (c *Credential) AddCredential() error {
+	if _, err := engine.Insert(c); err != nil {
+		if strings.Contains(err.Error(), "credential_id") {
+			return errs.ErrPasskeyRegistered
+		}
+		return errs.New(err)
+	}
+	return nil
+}
+
+// GetCredential finds a credential by its credential id.
+func (c *Credential) GetCredential(credentialId string) error {
+	if exist, err := engine.Where("credential_id = ?", credentialId).Get(c); err != nil {
+		return errs.New(err)
+	} else if !exist {
+		return errs.ErrPasskeyNotFound
+	}
+	return nil
+}
+
+// GetUserCredentials returns all credentials of user.
+func GetUserCredentials(id int64) ([]Credential, error) {
+	var credentials []Credential
+	if err := engine.Where("user_id = ?", id).Asc("id").Find(&credentials); err != nil {
+		return nil, errs.New(err)
+	}
+	return credentials, nil
+}
+
+// UseCredential records that credential has been used with signCount.
+// Only one of concurrent logins with the same sign count succeeds, unless authenticator doesn't count.
+func (c *Credential) UseCredential(signCount int64) error {
+	session := engine.ID(c.Id).Cols("sign_count", "last_used")
+	if signCount != 0 {
+		session = session.Where("sign_count < ?", signCount)
+	}
+	affected, err := session.Update(&Credential{SignCount: signCount, LastUsed: Now()})
+	if err != nil {
+		return errs.New(err)
+	}
+	if affected == 0 {
+		return errs.ErrInvalidPasskey
+	}
+	c.SignCount = signCount
+	return nil
+}
+
+// DeleteCredential removes a credential of user.
+func DeleteCredential(uid int64, id int64) error {
+	affected, err := engine.Where("user_id = ?", uid).ID(id).Delete(&Credential{})
+	if err != nil {
+		return errs.New(err)
+	}
+	if affected == 0 {
+		return errs.ErrPasskeyNotFound
+	}
+	return nil
+}
@@ -1,12 +1,14 @@
 package models
 
 import (
+	"errors"
 	"fmt"
 	. "github.com/go-pandora/core/conf"
 	"github.com/go-xorm/core"
 	"github.com/go-xorm/xorm"
 	_ "github.com/lib/pq"
 	"log"
+	"testing"
 )
 
 type BasicModel struct {
@@ -27,6 +29,12 @@ func init() {
 		Config.DBPassword))
 
 	if err != nil {
+		// tests which need database skip themselves by Ping.
+		if testing.Testing() {
+			log.Println("failed to connect to Postgres:" + err.Error())
+			engine = nil
+			return
+		}
 		log.Panicln("failed to connect to Postgres:" + err.Error())
 	}
 
@@ -35,4 +43,26 @@ func init() {
 
 	engine.DB().SetMaxIdleConns(10)
 	engine.DB().SetMaxOpenConns(100)
+
+	if err = engine.Ping(); err != nil && testing.Testing() {
+		log.Println("failed to connect to Postgres:" + err.Error())
+		return
+	}
+	if err = engine.Sync2(new(User), new(Role), new(Permission), new(UserRole), new(RolePermission),
+		new(Moderation), new(PasswordHistory), new(UserMFA), new(RecoveryCode),
+		new(Credential), new(Identity), new(OAuthClient), new(OAuthConsent),
+		new(SigningKey)); err != nil {
+		log.Panicln("failed to sync tables:" + err.Error())
+	}
+	if err = initRoles(); err != nil {
+		log.Panicln("failed to init roles:" + err.Error())
+	}
+}
+
+// Ping checks whether database is reachable.
+func Ping() error {
+	if engine == nil {
+		return errors.New("database is not configured")
+	}
+	return engine.Ping()
 }
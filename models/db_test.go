@@ -0,0 +1,10 @@
+package models
+
+import "testing"
+
+// requireDB skips a test if database is not available, e.g. when running without configuration.
+func requireDB(t *testing.T) {
+	if err := Ping(); err != nil {
+		t.Skip("database is not available: " + err.Error())
+	}
+}
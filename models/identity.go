@@ -0,0 +1,131 @@
+package models
+
+import (
+	"github.com/go-pandora/core/errs"
+	"strings"
+	"unicode/utf8"
+)
+
+// Identity is an external account of a user at an OAuth provider.
+type Identity struct {
+	Id       int64    `json:"id"`
+	UserId   int64    `json:"-"         xorm:"index notnull"`
+	Provider string   `json:"provider"  xorm:"unique(provider_subject) notnull"`
+	Subject  string   `json:"-"         xorm:"unique(provider_subject) notnull"` // id of user at provider
+	Email    string   `json:"email"`
+	CreateAt JsonTime `json:"create_at" xorm:"created"`
+}
+
+func (i *Identity) TableName() string {
+	return "external_identities"
+}
+
+// GetIdentity finds an identity by provider and subject, and returns false if it has not been linked.
+func (i *Identity) GetIdentity() (bool, error) {
+	exist, err := engine.Where("provider = ? AND subject = ?", i.Provider, i.Subject).Get(i)
+	if err != nil {
+		return false, errs.New(err)
+	}
+	return exist, nil
+}
+
+// LinkIdentity links an external account to user.
+// A user can only link one account of each provider.
+func (i *Identity) LinkIdentity() error {
+	if exist, err := engine.Where("user_id = ? AND provider = ?", i.UserId, i.Provider).Exist(&Identity{}); err != nil {
+		return errs.New(err)
+	} else if exist {
+		return errs.ErrIdentityLinked
+	}
+	if _, err := engine.Insert(i); err != nil {
+		if strings.Contains(err.Error(), "provider_subject") {
+			return errs.ErrIdentityLinked
+		}
+		return errs.New(err)
+	}
+	return nil
+}
+
+// GetUserIdentities returns external accounts linked to user.
+func GetUserIdentities(id int64) ([]Identity, error) {
+	var identities []Identity
+	if err := engine.Where("user_id = ?", id).Asc("provider").Find(&identities); err != nil {
+		return nil, errs.New(err)
+	}
+	return identities, nil
+}
+
+// UnlinkIdentity removes the external account of provider from user.
+// The last external account of a user who has neither password nor passkey can't be removed,
+// otherwise user could never log in again.
+func UnlinkIdentity(id int64, provider string) error {
+	var user User
+	if exist, err := engine.ID(id).Cols("password").Get(&user); err != nil {
+		return errs.New(err)
+	} else if !exist {
+		return errs.ErrUserNotFound
+	}
+	if user.Password == "" {
+		identities, err := engine.Where("user_id = ? AND provider <> ?", id, provider).Count(&Identity{})
+		if err != nil {
+			return errs.New(err)
+		}
+		passkeys, err := engine.Where("user_id = ?", id).Count(&Credential{})
+		if err != nil {
+			return errs.New(err)
+		}
+		if identities == 0 && passkeys == 0 {
+			return errs.ErrLastLoginMethod
+		}
+	}
+	if _, err := engine.Where("user_id = ? AND provider = ?", id, provider).Delete(&Identity{}); err != nil {
+		return errs.New(err)
+	}
+	return nil
+}
+
+// AddUserByIdentity creates a user for an external account and links them.
+// User has no password until it is reset, and email address is only kept if provider has verified it.
+func (i *Identity) AddUserByIdentity(name string) (*User, error) {
+	user := &User{Username: usernameOf(name, i), Status: Normal, LastModify: Now()}
+	if i.Email != "" {
+		email := i.Email
+		user.Email, user.EmailVerified = &email, true
+	}
+
+	session := engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return nil, errs.New(err)
+	}
+	if _, err := session.Insert(user); err != nil {
+		session.Rollback()
+		if strings.Contains(err.Error(), "email") {
+			return nil, errs.ErrAccountExists
+		}
+		return nil, errs.New(err)
+	}
+	i.UserId = user.Id
+	if _, err := session.Insert(i); err != nil {
+		session.Rollback()
+		if strings.Contains(err.Error(), "provider_subject") {
+			return nil, errs.ErrIdentityLinked
+		}
+		return nil, errs.New(err)
+	}
+	if err := session.Commit(); err != nil {
+		return nil, errs.New(err)
+	}
+	return user, nil
+}
+
+// usernameOf picks a username for user created by an external account, which can be changed later.
+func usernameOf(name string, i *Identity) string {
+	if name == "" {
+		name = i.Provider + "_" + i.Subject
+	}
+	if utf8.RuneCountInString(name) > 16 {
+		name = string([]rune(name)[:16])
+	}
+	return name
+}
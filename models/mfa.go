@@ -0,0 +1,322 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/util/cryptoutil"
+	"github.com/go-pandora/core/util/randutil"
+	"github.com/go-pandora/core/util/totp"
+	"strings"
+	"time"
+)
+
+// UserMFA keeps the TOTP secret of a user.
+// Two-factor authentication is only enabled after user confirms a first code generated from the secret.
+type UserMFA struct {
+	Id       int64
+	UserId   int64    `xorm:"unique notnull"`
+	Secret   string   `xorm:"notnull"` // encrypted by key_encryption_key, only decrypted when loaded
+	Enabled  bool     `xorm:"notnull"`
+	LastStep int64    `xorm:"notnull"` // time step of the latest code used, codes can't be used again
+	CreateAt JsonTime `xorm:"created"`
+}
+
+// RecoveryCode is a one-time code for user who has lost his authenticator, only its hash is stored.
+type RecoveryCode struct {
+	Id     int64
+	UserId int64  `xorm:"index notnull"`
+	Code   string `xorm:"notnull"`
+}
+
+func (m *UserMFA) TableName() string {
+	return "user_mfa"
+}
+
+func (r *RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
+
+// MFAStatus tells whether user has enabled two-factor authentication, and whether any of his roles requires it.
+type MFAStatus struct {
+	Enabled       bool `json:"enabled"`
+	Required      bool `json:"required"`
+	RecoveryCodes int  `json:"recovery_codes"` // how many recovery codes are left
+}
+
+// GetMFAStatus returns the two-factor authentication status of user.
+func GetMFAStatus(id int64) (*MFAStatus, error) {
+	status := &MFAStatus{}
+	mfa, err := getMFA(id)
+	if err != nil {
+		return nil, err
+	}
+	if mfa != nil && mfa.Enabled {
+		status.Enabled = true
+		count, err := engine.Where("user_id = ?", id).Count(&RecoveryCode{})
+		if err != nil {
+			return nil, errs.New(err)
+		}
+		status.RecoveryCodes = int(count)
+	}
+	status.Required, err = engine.Where("require_mfa = ? AND id IN (SELECT role_id FROM user_roles WHERE user_id = ?)",
+		true, id).Exist(&Role{})
+	if err != nil {
+		return nil, errs.New(err)
+	}
+	return status, nil
+}
+
+// EnrollMFA generates a new TOTP secret for user, and returns it along with the provisioning URI.
+// Secret generated before is replaced until two-factor authentication is enabled.
+func EnrollMFA(id int64) (secret string, uri string, err error) {
+	var user User
+	if err = user.GetAccount(id); err != nil {
+		return "", "", err
+	}
+	mfa, err := getMFA(id)
+	if err != nil {
+		return "", "", err
+	}
+	if mfa != nil && mfa.Enabled {
+		return "", "", errs.ErrMFAEnabled
+	}
+
+	if secret, err = totp.GenerateSecret(); err != nil {
+		return "", "", errs.New(err)
+	}
+	sealed, err := sealSecret(secret)
+	if err != nil {
+		return "", "", errs.New(err)
+	}
+	if mfa != nil {
+		_, err = engine.ID(mfa.Id).Where("enabled = ?", false).Cols("secret").Update(&UserMFA{Secret: sealed})
+	} else {
+		_, err = engine.Insert(&UserMFA{UserId: id, Secret: sealed})
+	}
+	if err != nil {
+		return "", "", errs.New(err)
+	}
+	return secret, totp.URI(secret, Config.MFAIssuer, user.account()), nil
+}
+
+// ConfirmMFA enables two-factor authentication of user if code matches the enrolled secret,
+// and returns recovery codes, which are shown to user only this time.
+func ConfirmMFA(id int64, code string) ([]string, error) {
+	mfa, err := getMFA(id)
+	if err != nil {
+		return nil, err
+	}
+	if mfa == nil {
+		return nil, errs.ErrMFANotEnabled
+	}
+	if mfa.Enabled {
+		return nil, errs.ErrMFAEnabled
+	}
+	step, ok := totp.Validate(mfa.Secret, code, time.Now())
+	if !ok {
+		return nil, errs.ErrInvalidCode
+	}
+
+	codes, hashed, err := generateRecoveryCodes(id)
+	if err != nil {
+		return nil, errs.New(err)
+	}
+	session := engine.NewSession()
+	defer session.Close()
+	if err = session.Begin(); err != nil {
+		return nil, errs.New(err)
+	}
+	affected, err := session.ID(mfa.Id).Where("enabled = ?", false).Cols("enabled", "last_step").
+		Update(&UserMFA{Enabled: true, LastStep: int64(step)})
+	if err != nil {
+		session.Rollback()
+		return nil, errs.New(err)
+	}
+	if affected == 0 {
+		session.Rollback()
+		return nil, errs.ErrMFAEnabled
+	}
+	if _, err = session.Delete(&RecoveryCode{UserId: id}); err != nil {
+		session.Rollback()
+		return nil, errs.New(err)
+	}
+	if _, err = session.Insert(&hashed); err != nil {
+		session.Rollback()
+		return nil, errs.New(err)
+	}
+	if err = session.Commit(); err != nil {
+		return nil, errs.New(err)
+	}
+	return codes, nil
+}
+
+// VerifyMFA checks the second factor of user, which is either a TOTP code or a recovery code.
+// Each of them can only be used once.
+func VerifyMFA(id int64, code string) error {
+	mfa, err := getMFA(id)
+	if err != nil {
+		return err
+	}
+	if mfa == nil || !mfa.Enabled {
+		return errs.ErrMFANotEnabled
+	}
+
+	if step, ok := totp.Validate(mfa.Secret, code, time.Now()); ok {
+		// Only one of concurrent requests with the same code is able to move the step forward.
+		affected, err := engine.ID(mfa.Id).Where("last_step < ?", step).Cols("last_step").
+			Update(&UserMFA{LastStep: int64(step)})
+		if err != nil {
+			return errs.New(err)
+		}
+		if affected == 0 {
+			return errs.ErrInvalidCode
+		}
+		return nil
+	}
+
+	deleted, err := engine.Delete(&RecoveryCode{UserId: id, Code: hashRecoveryCode(code)})
+	if err != nil {
+		return errs.New(err)
+	}
+	if deleted == 0 {
+		return errs.ErrInvalidCode
+	}
+	return nil
+}
+
+// DisableMFA turns off two-factor authentication of user after checking code.
+// User can't turn it off if any of his roles requires it.
+func DisableMFA(id int64, code string) error {
+	status, err := GetMFAStatus(id)
+	if err != nil {
+		return err
+	}
+	if !status.Enabled {
+		return errs.ErrMFANotEnabled
+	}
+	if status.Required {
+		return errs.ErrMFARequired
+	}
+	if err = VerifyMFA(id, code); err != nil {
+		return err
+	}
+
+	session := engine.NewSession()
+	defer session.Close()
+	if err = session.Begin(); err != nil {
+		return errs.New(err)
+	}
+	if _, err = session.Delete(&UserMFA{UserId: id}); err != nil {
+		session.Rollback()
+		return errs.New(err)
+	}
+	if _, err = session.Delete(&RecoveryCode{UserId: id}); err != nil {
+		session.Rollback()
+		return errs.New(err)
+	}
+	if err = session.Commit(); err != nil {
+		return errs.New(err)
+	}
+	return nil
+}
+
+// SetRoleMFA sets whether users of a role must log in with two-factor authentication.
+func SetRoleMFA(name string, required bool) error {
+	role, err := getRole(name)
+	if err != nil {
+		return err
+	}
+	if _, err = engine.ID(role.Id).Cols("require_mfa").Update(&Role{RequireMFA: required}); err != nil {
+		return errs.New(err)
+	}
+	return nil
+}
+
+func getMFA(id int64) (*UserMFA, error) {
+	mfa := &UserMFA{UserId: id}
+	if exist, err := engine.Get(mfa); err != nil {
+		return nil, errs.New(err)
+	} else if !exist {
+		return nil, nil
+	}
+	secret, err := openSecret(mfa.Secret)
+	if err != nil {
+		return nil, errs.New(err)
+	}
+	mfa.Secret = secret
+	return mfa, nil
+}
+
+// sealSecret encrypts a TOTP secret like signing keys, so that a leaked database doesn't leak second factors.
+func sealSecret(secret string) (string, error) {
+	sealed, err := cryptoutil.Seal(Config.KeyEncryptionKey, []byte(secret))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func openSecret(sealed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	secret, err := cryptoutil.Open(Config.KeyEncryptionKey, data)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// generateRecoveryCodes returns Config.MFARecoveryCodes codes for user and their hashed records.
+// Codes look like "1a2b3-c4d5e".
+func generateRecoveryCodes(id int64) ([]string, []RecoveryCode, error) {
+	codes := make([]string, Config.MFARecoveryCodes)
+	hashed := make([]RecoveryCode, Config.MFARecoveryCodes)
+	for i := range codes {
+		token, err := randutil.Token(5)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes[i] = token[:5] + "-" + token[5:]
+		hashed[i] = RecoveryCode{UserId: id, Code: hashRecoveryCode(codes[i])}
+	}
+	return codes, hashed, nil
+}
+
+// hashRecoveryCode hashes code regardless of case and separators, as users may type it either way.
+// Recovery codes are random enough, so a fast hash is sufficient.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// account names user in authenticator apps.
+func (u *User) account() string {
+	switch {
+	case u.Email != nil && *u.Email != "":
+		return *u.Email
+	case u.Cellphone != nil && *u.Cellphone != "":
+		return *u.Cellphone
+	default:
+		return u.Username
+	}
+}
+
+// GetUsersWithoutMFA returns ids of users of a role who haven't enabled two-factor authentication.
+func GetUsersWithoutMFA(name string) ([]int64, error) {
+	role, err := getRole(name)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	if err = engine.Table("user_roles").Where("role_id = ? AND user_id NOT IN "+
+		"(SELECT user_id FROM user_mfa WHERE enabled = ?)", role.Id, true).Cols("user_id").Find(&ids); err != nil {
+		return nil, errs.New(err)
+	}
+	return ids, nil
+}
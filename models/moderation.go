@@ -0,0 +1,176 @@
+package models
+
+import (
+	"github.com/go-pandora/core/errs"
+	"time"
+)
+
+// Moderation records an action taken by an administrator on a user.
+type Moderation struct {
+	Id       int64    `json:"id"`
+	UserId   int64    `json:"user_id"   xorm:"index notnull"`
+	AdminId  int64    `json:"admin_id"  xorm:"notnull"`
+	Action   string   `json:"action"    xorm:"notnull"`
+	Reason   string   `json:"reason"`
+	ExpireAt JsonTime `json:"expire_at"` // zero means the action never expires
+	Lifted   bool     `json:"lifted"`    // whether a restriction or ban has been lifted
+	CreateAt JsonTime `json:"create_at" xorm:"created"`
+}
+
+// Moderation actions
+const (
+	ActionRestrict = "restrict"
+	ActionBan      = "ban"
+	ActionRestore  = "restore"
+	ActionActivate = "activate"
+)
+
+func (m *Moderation) TableName() string {
+	return "moderations"
+}
+
+// Moderate changes status of user and records the action.
+// A new restriction or ban replaces the active one, and restoring user lifts it.
+func (m *Moderation) Moderate() error {
+	var (
+		from []int
+		to   int
+	)
+	switch m.Action {
+	case ActionRestrict:
+		from, to = []int{Normal, Restricted, Banned}, Restricted
+	case ActionBan:
+		from, to = []int{Normal, Restricted, Banned}, Banned
+	case ActionRestore:
+		from, to = []int{Restricted, Banned}, Normal
+		m.ExpireAt = JsonTime{}
+	case ActionActivate:
+		from, to = []int{Inactive}, Normal
+		m.ExpireAt = JsonTime{}
+	default:
+		return errs.ErrInvalidParam
+	}
+
+	var user User
+	if exist, err := engine.ID(m.UserId).Cols("id", "status").Get(&user); err != nil {
+		return errs.New(err)
+	} else {
+		if !exist {
+			return errs.ErrUserNotFound
+		}
+	}
+	if !containsStatus(from, user.Status) {
+		return statusError(user.Status)
+	}
+
+	session := engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return errs.New(err)
+	}
+	if _, err := session.ID(m.UserId).Cols("status").Update(&User{Status: to}); err != nil {
+		session.Rollback()
+		return errs.New(err)
+	}
+	if _, err := session.Where("user_id = ? AND lifted = ?", m.UserId, false).
+		In("action", ActionRestrict, ActionBan).Cols("lifted").Update(&Moderation{Lifted: true}); err != nil {
+		session.Rollback()
+		return errs.New(err)
+	}
+	m.Lifted = m.Action == ActionRestore || m.Action == ActionActivate
+	if _, err := session.Insert(m); err != nil {
+		session.Rollback()
+		return errs.New(err)
+	}
+	if err := session.Commit(); err != nil {
+		return errs.New(err)
+	}
+	return nil
+}
+
+// GetModerations returns all actions taken on user, the latest comes first.
+func GetModerations(id int64) ([]Moderation, error) {
+	var moderations []Moderation
+	if err := engine.Where("user_id = ?", id).Desc("id").Find(&moderations); err != nil {
+		return nil, errs.New(err)
+	}
+	return moderations, nil
+}
+
+// LiftExpiredModerations restores all users whose restriction or ban has expired.
+func LiftExpiredModerations() error {
+	var moderations []Moderation
+	if err := engine.Where("lifted = ? AND expire_at IS NOT NULL AND expire_at <= ?", false, time.Now()).
+		In("action", ActionRestrict, ActionBan).Find(&moderations); err != nil {
+		return errs.New(err)
+	}
+	for _, m := range moderations {
+		if err := liftModeration(&m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// liftExpiredModeration restores user if his restriction or ban has expired.
+func (u *User) liftExpiredModeration() error {
+	var m Moderation
+	if exist, err := engine.Where("user_id = ? AND lifted = ?", u.Id, false).
+		In("action", ActionRestrict, ActionBan).Desc("id").Get(&m); err != nil {
+		return errs.New(err)
+	} else {
+		if !exist {
+			return nil
+		}
+	}
+	if time.Time(m.ExpireAt).IsZero() || time.Time(m.ExpireAt).After(time.Now()) {
+		return nil
+	}
+	if err := liftModeration(&m); err != nil {
+		return err
+	}
+	u.Status = Normal
+	return nil
+}
+
+func liftModeration(m *Moderation) error {
+	session := engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return errs.New(err)
+	}
+	if _, err := session.ID(m.Id).Cols("lifted").Update(&Moderation{Lifted: true}); err != nil {
+		session.Rollback()
+		return errs.New(err)
+	}
+	if _, err := session.ID(m.UserId).In("status", Restricted, Banned).Cols("status").
+		Update(&User{Status: Normal}); err != nil {
+		session.Rollback()
+		return errs.New(err)
+	}
+	if err := session.Commit(); err != nil {
+		return errs.New(err)
+	}
+	return nil
+}
+
+func containsStatus(statuses []int, status int) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// statusError describes why an action can not be taken on user of such status.
+func statusError(status int) error {
+	switch status {
+	case Inactive:
+		return errs.ErrUserInactive
+	case Normal:
+		return errs.ErrUserNormal
+	default:
+		return errs.ErrUserActivated
+	}
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-xorm/xorm"
+	"golang.org/x/crypto/bcrypt"
+	"time"
+)
+
+// PasswordHistory keeps recent password hashes of a user, so that they can't be reused.
+// The current password is also recorded, and only the latest Config.PasswordHistory records are kept.
+type PasswordHistory struct {
+	Id       int64
+	UserId   int64    `xorm:"index notnull"`
+	Password string   `xorm:"notnull"`
+	CreateAt JsonTime `xorm:"created"`
+}
+
+func (h *PasswordHistory) TableName() string {
+	return "password_histories"
+}
+
+// checkPasswordReuse returns ErrPasswordReused if password matches the current one or any recent one of user.
+func checkPasswordReuse(id int64, current string, password string) error {
+	if Config.PasswordHistory < 0 {
+		return nil
+	}
+	var histories []PasswordHistory
+	if err := engine.Where("user_id = ?", id).Desc("id").Limit(Config.PasswordHistory).
+		Find(&histories); err != nil {
+		return errs.New(err)
+	}
+	// Users registered before history is kept only have their current password.
+	hashes := []string{current}
+	for _, h := range histories {
+		if h.Password != current {
+			hashes = append(hashes, h.Password)
+		}
+	}
+	for _, hash := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			return errs.ErrPasswordReused
+		}
+	}
+	return nil
+}
+
+// recordPassword adds hash to history of user, and forgets old ones.
+func recordPassword(session *xorm.Session, id int64, hash string) error {
+	if Config.PasswordHistory < 0 {
+		return nil
+	}
+	if _, err := session.Insert(&PasswordHistory{UserId: id, Password: hash}); err != nil {
+		return err
+	}
+	_, err := session.Exec("DELETE FROM password_histories WHERE user_id = ? AND id NOT IN "+
+		"(SELECT id FROM password_histories WHERE user_id = ? ORDER BY id DESC LIMIT ?)",
+		id, id, Config.PasswordHistory)
+	return err
+}
+
+// passwordExpired checks whether password of user is older than Config.PasswordMaxAge.
+// Age of password is counted from the last modification, or from registration if it has never been changed.
+func (u *User) passwordExpired() bool {
+	if Config.PasswordMaxAge == 0 {
+		return false
+	}
+	modified := time.Time(u.LastModify)
+	if modified.IsZero() {
+		modified = time.Time(u.CreateAt)
+	}
+	return !modified.IsZero() && time.Since(modified) > Config.PasswordMaxAge
+}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"github.com/go-pandora/core/errs"
+	"strings"
+)
+
+type Role struct {
+	BasicModel  `xorm:"extends"`
+	Name        string `json:"name"        xorm:"unique notnull"`
+	Description string `json:"description"`
+	RequireMFA  bool   `json:"require_mfa" xorm:"notnull default false"` // users of this role must log in with 2FA
+}
+
+type Permission struct {
+	BasicModel  `xorm:"extends"`
+	Name        string `json:"name"        xorm:"unique notnull"`
+	Description string `json:"description"`
+}
+
+type UserRole struct {
+	Id     int64
+	UserId int64 `xorm:"unique(user_role) notnull"`
+	RoleId int64 `xorm:"unique(user_role) notnull"`
+}
+
+type RolePermission struct {
+	Id           int64
+	RoleId       int64 `xorm:"unique(role_permission) notnull"`
+	PermissionId int64 `xorm:"unique(role_permission) notnull"`
+}
+
+// Built-in roles
+const (
+	RoleAdmin = "admin"
+)
+
+// Built-in permissions
+const (
+	PermUserRead     = "user:read"     // read information of any user
+	PermUserModerate = "user:moderate" // restrict, ban or activate users
+	PermRoleManage   = "role:manage"   // assign roles to users or revoke them
+	PermClientManage = "client:manage" // register OAuth apps or delete them
+	PermKeyManage    = "key:manage"    // rotate keys which sign tokens
+)
+
+// defaultRoles will be created if they do not exist.
+var defaultRoles = map[string][]string{
+	RoleAdmin: {PermUserRead, PermUserModerate, PermRoleManage, PermClientManage, PermKeyManage},
+}
+
+func (r *Role) TableName() string {
+	return "roles"
+}
+
+func (p *Permission) TableName() string {
+	return "permissions"
+}
+
+func (ur *UserRole) TableName() string {
+	return "user_roles"
+}
+
+func (rp *RolePermission) TableName() string {
+	return "role_permissions"
+}
+
+// initRoles creates built-in roles and permissions.
+func initRoles() error {
+	for name, permissions := range defaultRoles {
+		role := Role{Name: name}
+		if err := getOrInsert(&role); err != nil {
+			return err
+		}
+		for _, p := range permissions {
+			permission := Permission{Name: p}
+			if err := getOrInsert(&permission); err != nil {
+				return err
+			}
+			if err := getOrInsert(&RolePermission{RoleId: role.Id, PermissionId: permission.Id}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func getOrInsert(bean interface{}) error {
+	exist, err := engine.Get(bean)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		_, err = engine.Insert(bean)
+	}
+	return err
+}
+
+// GetRoles returns all roles.
+func GetRoles() ([]Role, error) {
+	var roles []Role
+	if err := engine.Asc("id").Find(&roles); err != nil {
+		return nil, errs.New(err)
+	}
+	return roles, nil
+}
+
+// GetUserRoles returns names of all roles of user.
+func GetUserRoles(id int64) ([]string, error) {
+	var roles []string
+	if err := engine.Table("roles").Join("INNER", "user_roles", "user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", id).Asc("roles.name").Cols("roles.name").Find(&roles); err != nil {
+		return nil, errs.New(err)
+	}
+	return roles, nil
+}
+
+// GetRolePermissions returns names of all permissions granted to any of roles.
+func GetRolePermissions(roles []string) ([]string, error) {
+	var permissions []string
+	if len(roles) == 0 {
+		return permissions, nil
+	}
+	if err := engine.Table("permissions").Distinct("permissions.name").
+		Join("INNER", "role_permissions", "role_permissions.permission_id = permissions.id").
+		Join("INNER", "roles", "roles.id = role_permissions.role_id").
+		In("roles.name", roles).Find(&permissions); err != nil {
+		return nil, errs.New(err)
+	}
+	return permissions, nil
+}
+
+// AssignRole grants a role to user.
+func AssignRole(id int64, name string) error {
+	role, err := getRole(name)
+	if err != nil {
+		return err
+	}
+	if exist, err := engine.ID(id).Exist(&User{}); err != nil {
+		return errs.New(err)
+	} else {
+		if !exist {
+			return errs.ErrUserNotFound
+		}
+	}
+	if err := getOrInsert(&UserRole{UserId: id, RoleId: role.Id}); err != nil {
+		return errs.New(err)
+	}
+	return nil
+}
+
+// RevokeRole takes a role back from user.
+func RevokeRole(id int64, name string) error {
+	role, err := getRole(name)
+	if err != nil {
+		return err
+	}
+	if _, err := engine.Delete(&UserRole{UserId: id, RoleId: role.Id}); err != nil {
+		return errs.New(err)
+	}
+	return nil
+}
+
+func getRole(name string) (*Role, error) {
+	role := &Role{Name: strings.ToLower(name)}
+	if exist, err := engine.Get(role); err != nil {
+		return nil, errs.New(err)
+	} else {
+		if !exist {
+			return nil, errs.ErrRoleNotFound
+		}
+	}
+	return role, nil
+}
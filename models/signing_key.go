@@ -0,0 +1,79 @@
+package models
+
+import (
+	"github.com/go-pandora/core/errs"
+	"time"
+)
+
+// Kinds of signing keys, access tokens and refresh tokens are never signed by the same key.
+const (
+	KeyAccess  = "access"
+	KeyRefresh = "refresh"
+)
+
+// SigningKey is a key which signs JWT, shared by all servers.
+// The newest key of each kind signs new tokens, older ones only verify tokens until they retire.
+type SigningKey struct {
+	Id        int64    `json:"-"`
+	Kid       string   `json:"kid"       xorm:"unique(kind_kid) notnull"`
+	Kind      string   `json:"kind"      xorm:"unique(kind_kid) notnull"`
+	Algorithm string   `json:"algorithm" xorm:"notnull"`
+	Material  []byte   `json:"-"         xorm:"notnull"` // HMAC secret or PEM encoded private key, encrypted by key_encryption_key
+	CreateAt  JsonTime `json:"create_at" xorm:"created"`
+	RetireAt  JsonTime `json:"retire_at"` // zero means key is still signing
+}
+
+func (k *SigningKey) TableName() string {
+	return "jwt_signing_keys"
+}
+
+// SigningKeyExists checks whether a key of kind has ever been added, even if it has retired.
+func SigningKeyExists(kind string, kid string) (bool, error) {
+	exist, err := engine.Where("kind = ? AND kid = ?", kind, kid).Exist(&SigningKey{})
+	if err != nil {
+		return false, errs.New(err)
+	}
+	return exist, nil
+}
+
+// GetActiveSigningKeys returns keys of kind which have not retired, the last one is the signing key.
+func GetActiveSigningKeys(kind string) ([]SigningKey, error) {
+	var keys []SigningKey
+	if err := engine.Where("kind = ? AND (retire_at IS NULL OR retire_at > ?)", kind, time.Now()).
+		Asc("id").Find(&keys); err != nil {
+		return nil, errs.New(err)
+	}
+	return keys, nil
+}
+
+// GetSigningKeys lists all keys from the newest, without their material.
+func GetSigningKeys() ([]SigningKey, error) {
+	var keys []SigningKey
+	if err := engine.Omit("material").Desc("id").Find(&keys); err != nil {
+		return nil, errs.New(err)
+	}
+	return keys, nil
+}
+
+// AddSigningKey makes k the signing key of its kind.
+// The previous signing key retires after lifetime, when all tokens signed by it have expired.
+func (k *SigningKey) AddSigningKey(lifetime time.Duration) error {
+	session := engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return errs.New(err)
+	}
+	retire := &SigningKey{RetireAt: JsonTime(time.Now().Add(lifetime))}
+	if _, err := session.Where("kind = ? AND retire_at IS NULL", k.Kind).Cols("retire_at").Update(retire); err != nil {
+		session.Rollback()
+		return errs.New(err)
+	}
+	if _, err := session.Insert(k); err != nil {
+		session.Rollback()
+		return errs.New(err)
+	}
+	if err := session.Commit(); err != nil {
+		return errs.New(err)
+	}
+	return nil
+}
@@ -4,11 +4,19 @@ import "time"
 
 type JsonTime time.Time
 
+// MarshalJSON formats time as "2006-01-02 15:04:05", and zero time as null.
 func (j JsonTime) MarshalJSON() ([]byte, error) {
+	if time.Time(j).IsZero() {
+		return []byte("null"), nil
+	}
 	return []byte(`"` + time.Time(j).Format("2006-01-02 15:04:05") + `"`), nil
 }
 
 func (j *JsonTime) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*j = JsonTime{}
+		return nil
+	}
 	local, err := time.ParseInLocation(`"2006-01-02 15:04:05"`, string(data), time.Local)
 	*j = JsonTime(local)
 	return err
@@ -2,32 +2,30 @@ package models
 
 import (
 	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/i18n"
 	"github.com/go-pandora/core/util/validation"
 	"golang.org/x/crypto/bcrypt"
 	"strings"
+	"unicode/utf8"
 )
 
 type User struct {
-	BasicModel  `xorm:"extends"`
-	Username    string      `json:"username"`
-	Password    string      `json:"password,omitempty"`
-	Avatar      []byte      `json:"avatar,omitempty" xorm:"-"`
-	Age         int         `json:"age,omitempty"`
-	Gender      int         `json:"gender,omitempty"`
-	Address     string      `json:"address,omitempty"`
-	Description string      `json:"description,omitempty"`
-	Email       *string     `json:"email,omitempty"`
-	Cellphone   *string     `json:"cellphone,omitempty"`
-	Auth        []Authority `json:"-" xorm:"extends"`
-	Status      int         `json:"-"`
-	LastLogin   JsonTime    `json:"-"`
-	LastModify  JsonTime    `json:"-"`
-}
-
-type Authority struct {
-	BasicModel `xorm:"extends"`
-	Role       string
-	User       []User `xorm:"extends"`
+	BasicModel        `xorm:"extends"`
+	Username          string   `json:"username"`
+	Password          string   `json:"password,omitempty"`
+	Avatar            []byte   `json:"avatar,omitempty" xorm:"-"`
+	Age               int      `json:"age,omitempty"`
+	Gender            int      `json:"gender,omitempty"`
+	Address           string   `json:"address,omitempty"`
+	Description       string   `json:"description,omitempty"`
+	Email             *string  `json:"email,omitempty"`
+	Cellphone         *string  `json:"cellphone,omitempty"`
+	CellphoneVerified bool     `json:"-"`
+	EmailVerified     bool     `json:"-"` // set by activation or email change, which prove the address is owned
+	Language          string   `json:"language,omitempty"`
+	Status            int      `json:"-"`
+	LastLogin         JsonTime `json:"-"`
+	LastModify        JsonTime `json:"-"`
 }
 
 // Define user's status
@@ -60,6 +58,11 @@ func (u *User) GetUser(id int64) error {
 			return errs.ErrUserNotFound
 		}
 	}
+	if u.Status == Restricted || u.Status == Banned {
+		if err := u.liftExpiredModeration(); err != nil {
+			return err
+		}
+	}
 	switch u.Status {
 	case Inactive:
 		return errs.ErrUserInactive
@@ -82,7 +85,15 @@ func (u *User) AddUser() error {
 	if err := encodePassword(&u.Password); err != nil {
 		return errs.New(err)
 	}
-	if _, err := engine.Insert(u); err != nil {
+	u.LastModify = Now()
+
+	session := engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return errs.New(err)
+	}
+	if _, err := session.Insert(u); err != nil {
+		session.Rollback()
 		if strings.Contains(err.Error(), "email") {
 			return errs.ErrEmailUsed
 		} else if strings.Contains(err.Error(), "cellphone") {
@@ -91,12 +102,22 @@ func (u *User) AddUser() error {
 			return errs.New(err)
 		}
 	}
+	if err := recordPassword(session, u.Id, u.Password); err != nil {
+		session.Rollback()
+		return errs.New(err)
+	}
+	if err := session.Commit(); err != nil {
+		return errs.New(err)
+	}
 	return nil
 }
 
 // UpdateUserProfile will update user's profile.
 func (u *User) UpdateUserProfile(id int64) error {
-	if _, err := engine.ID(id).Cols("age", "gender", "address", "description").
+	if err := u.validateProfile(); err != nil {
+		return err
+	}
+	if _, err := engine.ID(id).Cols("age", "gender", "address", "description", "language").
 		Update(u); err != nil {
 		return errs.New(err)
 	}
@@ -105,16 +126,22 @@ func (u *User) UpdateUserProfile(id int64) error {
 
 // Login compares password provided by user and password stored in database.
 // If user logs in successfully, login time will be recorded.
+// If password is correct but has expired, ErrPasswordExpired is returned and user must change it first.
 func (u *User) Login() error {
 	pw := u.Password
 	u.Password = ""
-	if exist, err := engine.Cols("id", "password", "status").Get(u); err != nil {
+	if exist, err := engine.Cols("id", "password", "status", "create_at", "last_modify").Get(u); err != nil {
 		return errs.New(err)
 	} else {
 		if !exist {
 			return errs.ErrUserNotFound
 		}
 	}
+	if u.Status == Restricted || u.Status == Banned {
+		if err := u.liftExpiredModeration(); err != nil {
+			return err
+		}
+	}
 	// TODO: there should be more details if user's account is inactive, restricted or banned.
 	switch u.Status {
 	case Inactive:
@@ -127,6 +154,9 @@ func (u *User) Login() error {
 	if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(pw)); err != nil {
 		return errs.ErrWrongPassword
 	}
+	if u.passwordExpired() {
+		return errs.ErrPasswordExpired
+	}
 	var loginTime = Now()
 	if _, err := engine.ID(u.Id).Cols("last_login").Update(&User{LastLogin: loginTime}); err != nil {
 		return errs.New(err)
@@ -134,51 +164,234 @@ func (u *User) Login() error {
 	return nil
 }
 
+// GetLoginUserId finds id of the user who logs in with email address, cellphone number or username,
+// zero if there is no such user.
+func GetLoginUserId(email *string, cellphone *string, username string) (int64, error) {
+	user := User{Email: email, Cellphone: cellphone, Username: username}
+	if exist, err := engine.Cols("id").Get(&user); err != nil {
+		return 0, errs.New(err)
+	} else if !exist {
+		return 0, nil
+	}
+	return user.Id, nil
+}
+
+// GetUserByContact finds a user by email address or cellphone number.
+func (u *User) GetUserByContact() error {
+	if u.Email == nil && u.Cellphone == nil {
+		return errs.ErrInfoRequired
+	}
+	if exist, err := engine.Cols("id", "username", "email", "email_verified", "cellphone", "status").Get(u); err != nil {
+		return errs.New(err)
+	} else {
+		if !exist {
+			return errs.ErrUserNotFound
+		}
+	}
+	return nil
+}
+
+// GetAccount finds a user by id regardless of status.
+// Only id, username, email address, cellphone number and status are loaded.
+func (u *User) GetAccount(id int64) error {
+	if exist, err := engine.ID(id).Cols("id", "username", "email", "cellphone", "status").Get(u); err != nil {
+		return errs.New(err)
+	} else {
+		if !exist {
+			return errs.ErrUserNotFound
+		}
+	}
+	return nil
+}
+
+// GetUserLanguage returns the language preferred by user.
+func GetUserLanguage(id int64) (string, error) {
+	var user User
+	if _, err := engine.ID(id).Cols("language").Get(&user); err != nil {
+		return "", errs.New(err)
+	}
+	return user.Language, nil
+}
+
+// ChangeEmail replaces email address of user.
+// Caller should make sure that user owns the new address, which is then marked as verified.
 func (u *User) ChangeEmail() error {
-	if _, err := engine.ID(u.Id).Cols("email").Update(u); err != nil {
+	if u.Email == nil {
+		return errs.ErrInvalidEmail
+	}
+	if err := validation.ValidateEmail(*u.Email); err != nil {
+		return errs.ErrInvalidEmail
+	}
+	u.EmailVerified = true
+	if _, err := engine.ID(u.Id).Cols("email", "email_verified").Update(u); err != nil {
+		if strings.Contains(err.Error(), "email") {
+			return errs.ErrEmailUsed
+		}
 		return errs.New(err)
 	}
 	return nil
 }
 
+// CheckEmailUnused returns ErrEmailUsed if email address has been used by any user.
+func CheckEmailUnused(email string) error {
+	if exist, err := engine.Where("email = ?", email).Exist(&User{}); err != nil {
+		return errs.New(err)
+	} else if exist {
+		return errs.ErrEmailUsed
+	}
+	return nil
+}
+
+// ChangeCellphone replaces cellphone number of user.
+// Caller should make sure that user owns the new number, which is then marked as verified.
 func (u *User) ChangeCellphone() error {
-	if _, err := engine.ID(u.Id).Cols("cellphone").Update(u); err != nil {
+	if u.Cellphone == nil {
+		return errs.ErrInvalidCellphone
+	}
+	if err := validation.ValidateCellphone(*u.Cellphone); err != nil {
+		return errs.ErrInvalidCellphone
+	}
+	u.CellphoneVerified = true
+	if _, err := engine.ID(u.Id).Cols("cellphone", "cellphone_verified").Update(u); err != nil {
+		if strings.Contains(err.Error(), "cellphone") {
+			return errs.ErrCellphoneUsed
+		}
 		return errs.New(err)
 	}
 	return nil
 }
 
-func (u *User) ActivateUser() error {
-	return changeStatus(u.Id, Normal)
+// LoginByCellphone logs in user whose cellphone number has been verified by a one-time code.
+// Proving the number also verifies it, and activates user if he has not been activated.
+func (u *User) LoginByCellphone() error {
+	if u.Cellphone == nil {
+		return errs.ErrInvalidCellphone
+	}
+	if exist, err := engine.Where("cellphone = ?", *u.Cellphone).Cols("id", "status").Get(u); err != nil {
+		return errs.New(err)
+	} else {
+		if !exist {
+			return errs.ErrUserNotFound
+		}
+	}
+	if u.Status == Restricted || u.Status == Banned {
+		if err := u.liftExpiredModeration(); err != nil {
+			return err
+		}
+	}
+	if u.Status == Banned {
+		return errs.ErrUserBanned
+	}
+
+	update := &User{CellphoneVerified: true, LastLogin: Now()}
+	cols := []string{"cellphone_verified", "last_login"}
+	if u.Status == Inactive {
+		update.Status = Normal
+		cols = append(cols, "status")
+	}
+	if _, err := engine.ID(u.Id).Cols(cols...).Update(update); err != nil {
+		return errs.New(err)
+	}
+	return nil
 }
 
-func (u *User) RestrictUser() error {
-	return changeStatus(u.Id, Restricted)
+// LoginById logs in user who has proved himself without password, e.g. by a passkey or an external account.
+func (u *User) LoginById(id int64) error {
+	if exist, err := engine.ID(id).Cols("id", "status").Get(u); err != nil {
+		return errs.New(err)
+	} else if !exist {
+		return errs.ErrUserNotFound
+	}
+	if u.Status == Restricted || u.Status == Banned {
+		if err := u.liftExpiredModeration(); err != nil {
+			return err
+		}
+	}
+	switch u.Status {
+	case Inactive:
+		return errs.ErrUserInactive
+	case Banned:
+		return errs.ErrUserBanned
+	}
+	if _, err := engine.ID(u.Id).Cols("last_login").Update(&User{LastLogin: Now()}); err != nil {
+		return errs.New(err)
+	}
+	return nil
 }
 
-func (u *User) BanUser() error {
-	return changeStatus(u.Id, Banned)
+// ActivateUser activates an inactive account, whose email address is verified by the activation link.
+func (u *User) ActivateUser() error {
+	affected, err := engine.ID(u.Id).Where("status = ?", Inactive).Cols("status", "email_verified").
+		Update(&User{Status: Normal, EmailVerified: true})
+	if err != nil {
+		return errs.New(err)
+	}
+	if affected == 0 {
+		return errs.ErrUserActivated
+	}
+	return nil
 }
 
 // validateUserInfo validates whether user's information is valid.
-func (u *User) validateUserInfo() (err error) {
+// All invalid fields are reported in details of the returned error.
+func (u *User) validateUserInfo() error {
+	var details []errs.FieldError
 	if u.Email == nil && u.Cellphone == nil {
-		return errs.ErrInfoRequired
+		details = append(details, errs.Field("email", errs.ErrInfoRequired))
 	}
-	if err = validation.ValidateUsername(u.Username); err != nil {
-		return errs.ErrInvalidUsername
+	if err := validation.ValidateUsername(u.Username); err != nil {
+		details = append(details, errs.Field("username", errs.ErrInvalidUsername))
 	}
-	if err = validation.ValidatePassword(u.Password); err != nil {
-		return errs.ErrInvalidPassword
+	if err := validation.ValidatePassword(u.Password, u.Username); err != nil {
+		details = append(details, errs.Field("password", passwordError(err)))
 	}
 	if u.Email != nil {
-		if err = validation.ValidateEmail(*u.Email); err != nil {
-			return errs.ErrInvalidEmail
+		if err := validation.ValidateEmail(*u.Email); err != nil {
+			details = append(details, errs.Field("email", errs.ErrInvalidEmail))
 		}
 	}
 	if u.Cellphone != nil {
-		if err = validation.ValidateCellphone(*u.Cellphone); err != nil {
-			return errs.ErrInvalidCellphone
+		if err := validation.ValidateCellphone(*u.Cellphone); err != nil {
+			details = append(details, errs.Field("cellphone", errs.ErrInvalidCellphone))
+		}
+	}
+	details = append(details, u.profileErrors()...)
+
+	if len(details) > 0 {
+		return errs.ErrValidation.WithDetails(details...)
+	}
+	return nil
+}
+
+// validateProfile validates whether user's profile is valid.
+func (u *User) validateProfile() error {
+	if details := u.profileErrors(); len(details) > 0 {
+		return errs.ErrValidation.WithDetails(details...)
+	}
+	return nil
+}
+
+const (
+	maxAge               = 150
+	maxDescriptionLength = 256
+)
+
+// profileErrors also normalizes language to one of supported languages.
+func (u *User) profileErrors() (details []errs.FieldError) {
+	if u.Age < 0 || u.Age > maxAge {
+		details = append(details, errs.Field("age", errs.ErrInvalidAge))
+	}
+	switch u.Gender {
+	case Unknown, Male, Female:
+	default:
+		details = append(details, errs.Field("gender", errs.ErrInvalidGender))
+	}
+	if utf8.RuneCountInString(u.Description) > maxDescriptionLength {
+		details = append(details, errs.Field("description", errs.ErrInvalidDescription))
+	}
+	if u.Language != "" {
+		if u.Language = i18n.Match(u.Language); u.Language == "" {
+			details = append(details, errs.Field("language", errs.ErrInvalidLanguage))
 		}
 	}
 	return
@@ -194,27 +407,78 @@ func encodePassword(password *string) error {
 	return nil
 }
 
-func ChangePassword(id int64, old string, new string) error {
+// VerifyPassword checks user's current password, before a sensitive change is made by an authenticated user.
+func VerifyPassword(id int64, password string) error {
 	var user User
-	if err := user.GetUser(id); err != nil {
+	if exist, err := engine.ID(id).Cols("password").Get(&user); err != nil {
 		return errs.New(err)
+	} else if !exist {
+		return errs.ErrUserNotFound
 	}
-	if err := bcrypt.CompareHashAndPassword([]byte(old), []byte(user.Password)); err != nil {
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
 		return errs.ErrWrongPassword
 	}
-	if err := encodePassword(&user.Password); err != nil {
-		return errs.ErrEncodingPassword
+	return nil
+}
+
+// ChangePassword checks user's current password and replaces it with a new one.
+func ChangePassword(id int64, old string, new string) error {
+	var user User
+	if exist, err := engine.ID(id).Cols("id", "username", "password").Get(&user); err != nil {
+		return errs.New(err)
+	} else {
+		if !exist {
+			return errs.ErrUserNotFound
+		}
 	}
-	var modifyTime = Now()
-	if _, err := engine.ID(user.Id).Cols("password", "last_modify").
-		Update(&User{Password: user.Password, LastModify: modifyTime}); err != nil {
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(old)); err != nil {
+		return errs.ErrWrongPassword
+	}
+	return user.setPassword(new)
+}
+
+// ResetPassword sets a new password for user without checking the old one.
+// Caller should make sure that user has been verified by other means.
+func ResetPassword(id int64, password string) error {
+	var user User
+	if exist, err := engine.ID(id).Cols("id", "username", "password").Get(&user); err != nil {
 		return errs.New(err)
+	} else {
+		if !exist {
+			return errs.ErrUserNotFound
+		}
 	}
-	return nil
+	return user.setPassword(password)
 }
 
-func changeStatus(id int64, status int) error {
-	if _, err := engine.ID(id).Cols("status").Update(&User{Status: status}); err != nil {
+// setPassword replaces the current password of u, which should contain id, username and current password hash.
+// Recent passwords can't be reused.
+func (u *User) setPassword(password string) error {
+	if err := ValidatePassword(password, u.Username); err != nil {
+		return err
+	}
+	if err := checkPasswordReuse(u.Id, u.Password, password); err != nil {
+		return err
+	}
+	if err := encodePassword(&password); err != nil {
+		return err
+	}
+
+	session := engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return errs.New(err)
+	}
+	if _, err := session.ID(u.Id).Cols("password", "last_modify").
+		Update(&User{Password: password, LastModify: Now()}); err != nil {
+		session.Rollback()
+		return errs.New(err)
+	}
+	if err := recordPassword(session, u.Id, password); err != nil {
+		session.Rollback()
+		return errs.New(err)
+	}
+	if err := session.Commit(); err != nil {
 		return errs.New(err)
 	}
 	return nil
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"fmt"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-xorm/xorm"
+	"strings"
+	"time"
+)
+
+// UserFilter specifies conditions, order and page of users to list.
+type UserFilter struct {
+	Status        *int
+	Gender        *int
+	CreatedFrom   time.Time
+	CreatedTo     time.Time
+	LastLoginFrom time.Time
+	LastLoginTo   time.Time
+	Search        string // substring of username, email address or cellphone number
+	Sort          string // id, create_at, last_login or username
+	Desc          bool
+	Limit         int
+	Offset        int         // ignored if cursor is set
+	Cursor        *UserCursor // if cursor is set, only users after cursor will be listed
+}
+
+// UserCursor points to a user in a sorted list.
+type UserCursor struct {
+	Value string `json:"v"`
+	Id    int64  `json:"id"`
+}
+
+// userSortColumns maps sort keys to SQL expressions.
+// Users who never logged in come first in ascending order of last login.
+var userSortColumns = map[string]string{
+	"id":         "id",
+	"create_at":  "create_at",
+	"last_login": "COALESCE(last_login, '-infinity')",
+	"username":   "username",
+}
+
+const cursorTimeFormat = "2006-01-02 15:04:05.999999"
+
+// IsValidSort checks whether users can be sorted by key.
+func IsValidSort(key string) bool {
+	_, ok := userSortColumns[key]
+	return ok
+}
+
+// FindUsers lists users matching filter.
+// Users are sorted by the sort key and then id, so that order is stable across pages.
+// Total is the number of all matching users regardless of page.
+func FindUsers(f *UserFilter) (users []User, total int64, err error) {
+	if f.Sort == "" {
+		f.Sort = "id"
+	}
+	column, ok := userSortColumns[f.Sort]
+	if !ok {
+		return nil, 0, errs.ErrInvalidParam
+	}
+
+	countSession := engine.NewSession()
+	defer countSession.Close()
+	if total, err = f.where(countSession).Count(new(User)); err != nil {
+		return nil, 0, errs.New(err)
+	}
+
+	session := engine.NewSession()
+	defer session.Close()
+	f.where(session)
+
+	direction, compare := "ASC", ">"
+	if f.Desc {
+		direction, compare = "DESC", "<"
+	}
+	if f.Cursor != nil {
+		if f.Sort == "id" {
+			session.And(fmt.Sprintf("id %s ?", compare), f.Cursor.Id)
+		} else {
+			session.And(fmt.Sprintf("(%s, id) %s (?, ?)", column, compare), f.Cursor.Value, f.Cursor.Id)
+		}
+		session.Limit(f.Limit)
+	} else {
+		session.Limit(f.Limit, f.Offset)
+	}
+	if f.Sort != "id" {
+		session.OrderBy(fmt.Sprintf("%s %s", column, direction))
+	}
+	session.OrderBy(fmt.Sprintf("id %s", direction))
+
+	if err = session.Omit("password").Find(&users); err != nil {
+		return nil, 0, errs.New(err)
+	}
+	return users, total, nil
+}
+
+// where applies conditions of filter to session.
+func (f *UserFilter) where(session *xorm.Session) *xorm.Session {
+	if f.Status != nil {
+		session.And("status = ?", *f.Status)
+	}
+	if f.Gender != nil {
+		session.And("gender = ?", *f.Gender)
+	}
+	if !f.CreatedFrom.IsZero() {
+		session.And("create_at >= ?", f.CreatedFrom)
+	}
+	if !f.CreatedTo.IsZero() {
+		session.And("create_at <= ?", f.CreatedTo)
+	}
+	if !f.LastLoginFrom.IsZero() {
+		session.And("last_login >= ?", f.LastLoginFrom)
+	}
+	if !f.LastLoginTo.IsZero() {
+		session.And("last_login <= ?", f.LastLoginTo)
+	}
+	if f.Search != "" {
+		pattern := "%" + escapeLike(f.Search) + "%"
+		session.And("(username ILIKE ? OR email ILIKE ? OR cellphone ILIKE ?)", pattern, pattern, pattern)
+	}
+	return session
+}
+
+// CursorOf returns a cursor pointing to user in the order of filter.
+func (f *UserFilter) CursorOf(u *User) *UserCursor {
+	cursor := &UserCursor{Id: u.Id}
+	switch f.Sort {
+	case "create_at":
+		cursor.Value = time.Time(u.CreateAt).Format(cursorTimeFormat)
+	case "last_login":
+		if time.Time(u.LastLogin).IsZero() {
+			cursor.Value = "-infinity"
+		} else {
+			cursor.Value = time.Time(u.LastLogin).Format(cursorTimeFormat)
+		}
+	case "username":
+		cursor.Value = u.Username
+	}
+	return cursor
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -1,18 +1,26 @@
 package models
 
 import (
+	"fmt"
+	. "github.com/go-pandora/core/conf"
 	"github.com/go-pandora/core/errs"
 	"github.com/go-pandora/core/util/csvutil"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/crypto/bcrypt"
 	"log"
 	"testing"
+	"time"
 )
 
 func TestMain(m *testing.M) {
-	cleanData()
+	available := Ping() == nil
+	if available {
+		cleanData()
+	}
 	m.Run()
-	cleanData()
+	if available {
+		cleanData()
+	}
 }
 
 func cleanData() {
@@ -20,9 +28,13 @@ func cleanData() {
 	if err != nil {
 		log.Println(err)
 	}
+	if _, err = engine.Exec("truncate `password_histories` restart identity"); err != nil {
+		log.Println(err)
+	}
 }
 
 func TestUser_AddUser(t *testing.T) {
+	requireDB(t)
 	records, err := csvutil.GetTestData("../test/user_test.csv")
 	if err != nil {
 		t.Fatal("no test data")
@@ -52,11 +64,50 @@ func TestUser_AddUser(t *testing.T) {
 	assert := assert.New(t)
 	for i, user := range data {
 		err := user.AddUser()
-		assert.Equal(e[i], err)
+		assertErr(assert, e[i], err)
 	}
 }
 
+// assertErr asserts that err is expected, or is a validation error which reports expected in its details.
+func assertErr(assert *assert.Assertions, expected error, err error) {
+	if e, ok := err.(*errs.Err); ok && e.Code == errs.ErrValidation.Code {
+		code := expected.(*errs.Err).Code
+		for _, detail := range e.Details {
+			if detail.Code == code {
+				return
+			}
+		}
+		assert.Failf("missing field error", "expected %d in details %v", code, e.Details)
+		return
+	}
+	assert.Equal(expected, err)
+}
+
+func TestUser_AddUser_AllFieldErrors(t *testing.T) {
+	email := "pandora@@gmail.com"
+	cellphone := "12345"
+	user := User{Username: "Pa", Password: "short", Email: &email, Cellphone: &cellphone, Age: -1, Gender: 3}
+
+	err := user.AddUser()
+	e, ok := err.(*errs.Err)
+	if !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assert := assert.New(t)
+	assert.Equal(errs.ErrValidation.Code, e.Code)
+	assert.Equal([]errs.FieldError{
+		errs.Field("username", errs.ErrInvalidUsername),
+		errs.Field("password", errs.ErrInvalidPassword),
+		errs.Field("email", errs.ErrInvalidEmail),
+		errs.Field("cellphone", errs.ErrInvalidCellphone),
+		errs.Field("age", errs.ErrInvalidAge),
+		errs.Field("gender", errs.ErrInvalidGender),
+	}, e.Details)
+}
+
 func TestUser_GetUser(t *testing.T) {
+	requireDB(t)
 	email1 := "Pandora1@gmail.com"
 	email2 := "Pandora2@gmail.com"
 	cellphone1 := "13345643535"
@@ -87,6 +138,7 @@ func TestUser_GetUser(t *testing.T) {
 }
 
 func TestUser_UpdateUserProfile(t *testing.T) {
+	requireDB(t)
 	email := "pandora@gamil.com"
 	user := User{Username: "pandora", Password: "pandora", Age: 20, Email: &email, Description: "I am a programmer.",
 		Gender: Male}
@@ -113,7 +165,23 @@ func TestUser_UpdateUserProfile(t *testing.T) {
 	assert.NotEqual(user.Email, updateUser.Email) // email address won't be changed.
 }
 
+func TestUser_UpdateUserProfile_AllFieldErrors(t *testing.T) {
+	user := User{Age: maxAge + 1, Gender: 3, Language: "xx-unknown"}
+
+	err := user.UpdateUserProfile(0)
+	e, ok := err.(*errs.Err)
+	if !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, []errs.FieldError{
+		errs.Field("age", errs.ErrInvalidAge),
+		errs.Field("gender", errs.ErrInvalidGender),
+		errs.Field("language", errs.ErrInvalidLanguage),
+	}, e.Details)
+}
+
 func TestUser_Login(t *testing.T) {
+	requireDB(t)
 	email1 := "Pandora3@gmail.com"
 	email2 := "Pandora4@gmail.com"
 	cellphone1 := "13343643535"
@@ -157,3 +225,129 @@ func TestUser_Login(t *testing.T) {
 	err := incorrectUser.Login()
 	assert.Equal(errs.ErrWrongPassword, err)
 }
+
+func TestChangePassword(t *testing.T) {
+	requireDB(t)
+	email := "Pandora5@gmail.com"
+	user := User{Username: "Pandora5", Password: "Pandora&", Email: &email, Status: Normal}
+	hash, _ := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	user.Password = string(hash)
+	if _, err := engine.Table("users").Insert(&user); err != nil {
+		t.Fatal(err)
+	}
+
+	assert := assert.New(t)
+	assert.Equal(errs.ErrUserNotFound, ChangePassword(0, "Pandora&", "Pandora^new"))
+	assert.Equal(errs.ErrWrongPassword, ChangePassword(user.Id, "pandora&", "Pandora^new"))
+	// old password must be compared with the stored hash rather than the hash itself.
+	assert.Equal(errs.ErrWrongPassword, ChangePassword(user.Id, string(hash), "Pandora^new"))
+	assert.Equal(errs.ErrInvalidPassword, ChangePassword(user.Id, "Pandora&", "short"))
+	assert.Nil(ChangePassword(user.Id, "Pandora&", "Pandora^new"))
+
+	var updateUser User
+	if _, err := engine.Table("users").ID(user.Id).Get(&updateUser); err != nil {
+		t.Fatal(err)
+	}
+	// the new password rather than the old hash should be stored.
+	assert.Nil(bcrypt.CompareHashAndPassword([]byte(updateUser.Password), []byte("Pandora^new")))
+	assert.NotEqual(JsonTime{}, updateUser.LastModify)
+
+	loginUser := User{Email: &email, Password: "Pandora&"}
+	assert.Equal(errs.ErrWrongPassword, loginUser.Login())
+	loginUser = User{Email: &email, Password: "Pandora^new"}
+	assert.Nil(loginUser.Login())
+}
+
+func TestPasswordReuse(t *testing.T) {
+	requireDB(t)
+	email := "Pandora6@gmail.com"
+	user := User{Username: "Pandora6", Password: "Pandora^0", Email: &email}
+	if err := user.AddUser(); err != nil {
+		t.Fatal(err)
+	}
+
+	assert := assert.New(t)
+	assert.Equal(errs.ErrPasswordReused, ChangePassword(user.Id, "Pandora^0", "Pandora^0"))
+	assert.Nil(ChangePassword(user.Id, "Pandora^0", "Pandora^1"))
+	assert.Equal(errs.ErrPasswordReused, ResetPassword(user.Id, "Pandora^0"))
+	for i := 2; i <= Config.PasswordHistory; i++ {
+		assert.Nil(ResetPassword(user.Id, fmt.Sprintf("Pandora^%d", i)))
+	}
+	// only the latest passwords are remembered.
+	count, err := engine.Where("user_id = ?", user.Id).Count(new(PasswordHistory))
+	assert.Nil(err)
+	assert.Equal(int64(Config.PasswordHistory), count)
+	assert.Nil(ResetPassword(user.Id, "Pandora^0"))
+}
+
+func TestLogin_PasswordExpired(t *testing.T) {
+	requireDB(t)
+	email := "Pandora7@gmail.com"
+	user := User{Username: "Pandora7", Password: "Pandora^0", Email: &email}
+	if err := user.AddUser(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.ID(user.Id).Cols("status").Update(&User{Status: Normal}); err != nil {
+		t.Fatal(err)
+	}
+
+	maxAge := Config.PasswordMaxAge
+	defer func() { Config.PasswordMaxAge = maxAge }()
+	Config.PasswordMaxAge = time.Hour
+
+	assert := assert.New(t)
+	loginUser := User{Email: &email, Password: "Pandora^0"}
+	assert.Nil(loginUser.Login())
+
+	old := JsonTime(time.Now().Add(-2 * time.Hour))
+	if _, err := engine.ID(user.Id).Cols("last_modify").Update(&User{LastModify: old}); err != nil {
+		t.Fatal(err)
+	}
+	loginUser = User{Email: &email, Password: "Pandora^0"}
+	assert.Equal(errs.ErrPasswordExpired, loginUser.Login())
+	loginUser = User{Email: &email, Password: "Pandora^1"}
+	assert.Equal(errs.ErrWrongPassword, loginUser.Login())
+
+	assert.Nil(ChangePassword(user.Id, "Pandora^0", "Pandora^1"))
+	loginUser = User{Email: &email, Password: "Pandora^1"}
+	assert.Nil(loginUser.Login())
+}
+
+func TestEmailVerified(t *testing.T) {
+	requireDB(t)
+	email, cellphone := "Pandora8@gmail.com", "13800000008"
+	user := User{Username: "Pandora8", Password: "Pandora^0", Email: &email, Cellphone: &cellphone}
+	if err := user.AddUser(); err != nil {
+		t.Fatal(err)
+	}
+	verified := func() bool {
+		found := User{Email: &email}
+		if err := found.GetUserByContact(); err != nil {
+			t.Fatal(err)
+		}
+		return found.EmailVerified
+	}
+
+	assert := assert.New(t)
+	assert.False(verified())
+	// logging in by SMS activates the account, but doesn't prove the email address.
+	smsUser := User{Cellphone: &cellphone}
+	assert.Nil(smsUser.LoginByCellphone())
+	assert.False(verified())
+
+	if _, err := engine.ID(user.Id).Cols("status").Update(&User{Status: Inactive}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(user.ActivateUser())
+	assert.True(verified())
+
+	email = "Pandora8@outlook.com"
+	if _, err := engine.ID(user.Id).Cols("email", "email_verified").Update(&User{Email: &email}); err != nil {
+		t.Fatal(err)
+	}
+	assert.False(verified())
+	changed := User{Email: &email}
+	changed.Id = user.Id
+	assert.Nil(changed.ChangeEmail())
+	assert.True(verified())
+}
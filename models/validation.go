@@ -0,0 +1,52 @@
+package models
+
+import (
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/util/validation"
+	"log"
+)
+
+func init() {
+	if err := validation.SetPolicy(validation.Policy{
+		UsernameMinLength: Config.UsernameMinLength,
+		UsernameMaxLength: Config.UsernameMaxLength,
+		PasswordMinLength: Config.PasswordMinLength,
+		PasswordMaxLength: Config.PasswordMaxLength,
+		PasswordSymbols:   Config.PasswordSymbols,
+		RequireLower:      Config.RequireLower,
+		RequireUpper:      Config.RequireUpper,
+		RequireDigit:      Config.RequireDigit,
+		RequireSymbol:     Config.RequireSymbol,
+		DictionaryFile:    Config.DictionaryFile,
+		BreachedFile:      Config.BreachedFile,
+		CellphoneFormat:   Config.CellphoneFormat,
+	}); err != nil {
+		log.Panicln("failed to load validation policy:" + err.Error())
+	}
+}
+
+// ValidatePassword checks password against the password policy, and tells why it is rejected.
+func ValidatePassword(password string, username string) error {
+	if err := validation.ValidatePassword(password, username); err != nil {
+		return passwordError(err)
+	}
+	return nil
+}
+
+// passwordError converts an error of password validation.
+// Errors returned by custom rules are treated as ErrInvalidPassword.
+func passwordError(err error) *errs.Err {
+	switch err {
+	case validation.ErrPasswordTooWeak:
+		return errs.ErrPasswordTooWeak
+	case validation.ErrPasswordTooCommon:
+		return errs.ErrPasswordTooCommon
+	case validation.ErrPasswordBreached:
+		return errs.ErrPasswordBreached
+	case validation.ErrPasswordContainsUsername:
+		return errs.ErrPasswordContainsUsername
+	default:
+		return errs.ErrInvalidPassword
+	}
+}
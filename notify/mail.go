@@ -0,0 +1,104 @@
+// Package notify delivers messages such as emails to users.
+package notify
+
+import (
+	"fmt"
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/pkg/email"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Mail describes an email rendered from a html template.
+type Mail struct {
+	To       string
+	Subject  string
+	Template string
+	Data     map[string]string
+}
+
+// Mailer is used to deliver emails.
+type Mailer interface {
+	Send(m *Mail) error
+}
+
+var mailer Mailer
+
+func init() {
+	switch Config.MailDriver {
+	case "smtp":
+		mailer = NewSMTPMailer()
+	default:
+		var err error
+		if mailer, err = NewLogMailer(Config.MailFile); err != nil {
+			log.Panicln("failed to init mailer:" + err.Error())
+		}
+	}
+}
+
+// SetMailer replaces the default mailer.
+func SetMailer(m Mailer) {
+	mailer = m
+}
+
+// SendMail delivers an email by the configured mailer.
+func SendMail(m *Mail) error {
+	return mailer.Send(m)
+}
+
+// SMTPMailer sends emails through a SMTP server.
+type SMTPMailer struct {
+	client *email.Client
+}
+
+func NewSMTPMailer() *SMTPMailer {
+	return &SMTPMailer{
+		client: email.NewClient(Config.MailUsername, Config.MailPassword, Config.MailHost, Config.MailPort),
+	}
+}
+
+func (s *SMTPMailer) Send(m *Mail) error {
+	r := email.NewRequest(Config.MailFrom, m.Subject)
+	r.SetTo([]string{m.To})
+	if err := r.SetBody(filepath.Join(Config.TemplatePath, m.Template), m.Data); err != nil {
+		return err
+	}
+	return s.client.Send(r)
+}
+
+// LogMailer writes emails to a file or stderr instead of sending them.
+// It is useful when running Pandora locally.
+type LogMailer struct {
+	logger *log.Logger
+}
+
+// NewLogMailer creates a LogMailer. If path is empty, emails will be written to stderr.
+func NewLogMailer(path string) (*LogMailer, error) {
+	var w io.Writer = os.Stderr
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	return &LogMailer{logger: log.New(w, "[mail] ", log.LstdFlags)}, nil
+}
+
+func (l *LogMailer) Send(m *Mail) error {
+	keys := make([]string, 0, len(m.Data))
+	for k := range m.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	body := ""
+	for _, k := range keys {
+		body += fmt.Sprintf(" %s=%s", k, m.Data[k])
+	}
+	l.logger.Printf("to=%s subject=%q template=%s%s", m.To, m.Subject, m.Template, body)
+	return nil
+}
@@ -0,0 +1,38 @@
+package notify
+
+import (
+	"log"
+	"os"
+)
+
+// SMSSender is used to deliver short messages to cellphones.
+type SMSSender interface {
+	Send(cellphone, message string) error
+}
+
+var smsSender SMSSender = NewLogSMSSender()
+
+// SetSMSSender replaces the default SMS sender.
+func SetSMSSender(s SMSSender) {
+	smsSender = s
+}
+
+// SendSMS delivers a short message by the configured sender.
+func SendSMS(cellphone, message string) error {
+	return smsSender.Send(cellphone, message)
+}
+
+// LogSMSSender writes short messages to stderr instead of sending them.
+// It is useful when running Pandora locally.
+type LogSMSSender struct {
+	logger *log.Logger
+}
+
+func NewLogSMSSender() *LogSMSSender {
+	return &LogSMSSender{logger: log.New(os.Stderr, "[sms] ", log.LstdFlags)}
+}
+
+func (l *LogSMSSender) Send(cellphone, message string) error {
+	l.logger.Printf("to=%s message=%q", cellphone, message)
+	return nil
+}
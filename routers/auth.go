@@ -2,39 +2,23 @@ package routers
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/core/api"
 	"github.com/go-pandora/core/cache"
 	. "github.com/go-pandora/core/conf"
 	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/middleware"
+	"github.com/go-pandora/core/middleware/jwt"
 	"github.com/go-pandora/core/models"
-	"github.com/go-pandora/pkg/auth/jwt"
-	"log"
 	"net/http"
 	"strconv"
-	"strings"
+	"time"
 )
 
-var auth *jwt.JWTAuth
-
 type Response struct {
 	Message string      `json:"message"`
 	Data    interface{} `json:"data"`
 }
 
-func init() {
-	var err error
-	auth, err = jwt.NewJWTAuth(jwt.Options{
-		AccessPublicKey:      []byte(Config.AccessSecret),
-		RefreshPublicKey:     []byte(Config.RefreshSecret),
-		SigningMethod:        jwt.SetSigningMethod(Config.SigningAlgorithm),
-		AccessTokenDuration:  Config.Timeout,
-		RefreshTokenDuration: Config.MaxRefreshTime,
-	}, cache.IsJWTRevoked, cache.RevokeJWT)
-
-	if err != nil {
-		log.Panicln(err)
-	}
-}
-
 /*
 	*************************************
     *     JWT-Based Authentication      *
@@ -49,79 +33,406 @@ func LoginByJWT(c *gin.Context) {
 	)
 	defer func() { c.Set("error", err) }()
 
-	if c.BindJSON(&user) != nil {
+	if err = api.BindJSON(c, &user); err != nil {
 		return
 	}
 
-	if err = user.Login(); err != nil {
+	if err = api.Login(c, &user); err != nil {
 		return
 	}
 
-	id := strconv.FormatInt(user.Id, 10)
-	accessToken, err := auth.CreateAccessToken(id)
+	err = completeLogin(c, user.Id, issueTokens)
+}
+
+// LoginBySMS logs in by a one-time code sent to cellphone, without password.
+func LoginBySMS(c *gin.Context) {
+	user, err := api.LoginByOTP(c)
 	if err != nil {
-		err = errs.New(err)
+		c.Set("error", err)
 		return
 	}
-	refreshToken, err := auth.CreateRefreshToken(id)
+	if err = completeLogin(c, user.Id, issueTokens); err != nil {
+		c.Set("error", err)
+	}
+}
+
+// LoginByWebAuthn logs in by a passkey, and issues tokens like LoginByJWT.
+// A passkey which has verified user is already two factors, otherwise two-factor authentication follows if needed.
+func LoginByWebAuthn(c *gin.Context) {
+	user, verified, err := api.LoginByPasskey(c)
 	if err != nil {
-		err = errs.New(err)
+		c.Set("error", err)
 		return
 	}
-	c.JSON(http.StatusOK, Response{Data: gin.H{
+	if verified {
+		err = issueTokens(c, user.Id)
+	} else {
+		err = completeLogin(c, user.Id, issueTokens)
+	}
+	if err != nil {
+		c.Set("error", err)
+	}
+}
+
+// LoginByOAuth logs in by an external account at an OAuth provider, and issues tokens like LoginByJWT.
+func LoginByOAuth(c *gin.Context) {
+	user, err := api.LoginByOAuth(c)
+	if err != nil {
+		c.Set("error", err)
+		return
+	}
+	if err = completeLogin(c, user.Id, issueTokens); err != nil {
+		c.Set("error", err)
+	}
+}
+
+// LoginByMFA completes a login pending on two-factor authentication, and issues tokens like LoginByJWT.
+// Recovery codes are also returned if user has just enrolled.
+func LoginByMFA(c *gin.Context) {
+	var err error
+	defer func() { c.Set("error", err) }()
+
+	uid, codes, err := api.CompleteMFA(c)
+	if err != nil {
+		return
+	}
+	tokens, err := generateTokens(uid)
+	if err != nil {
+		return
+	}
+	if codes != nil {
+		tokens["recovery_codes"] = codes
+	}
+	c.JSON(http.StatusOK, Response{Data: tokens})
+}
+
+// completeLogin logs in user who has passed the first factor by start,
+// unless user has to pass two-factor authentication first.
+func completeLogin(c *gin.Context, uid int64, start func(*gin.Context, int64) error) error {
+	if pending, err := api.StartMFA(c, uid); err != nil || pending {
+		return err
+	}
+	return start(c, uid)
+}
+
+// issueTokens creates a pair of access token and refresh token for user and writes them to response.
+func issueTokens(c *gin.Context, uid int64) error {
+	tokens, err := generateTokens(uid)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusOK, Response{Data: tokens})
+	return nil
+}
+
+// generateTokens creates a pair of access token and refresh token for user.
+// Access token carries roles of user.
+func generateTokens(uid int64) (gin.H, error) {
+	roles, err := models.GetUserRoles(uid)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := jwt.GenerateAccessJWT(uid, roles)
+	if err != nil {
+		return nil, errs.New(err)
+	}
+	refreshToken, err := jwt.GenerateRefreshJWT(uid)
+	if err != nil {
+		return nil, errs.New(err)
+	}
+	return gin.H{
 		"access_token":  accessToken,
 		"refresh_token": refreshToken,
-	}})
+	}, nil
+}
+
+// GetJWKS publishes public keys which verify access tokens, so that other services can verify them
+// without sharing a secret. Keys are only published if tokens are signed by an asymmetric algorithm.
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, jwt.JWKS())
+}
+
+// GetSigningKeys lists keys which sign and verify tokens, their material is never returned.
+func GetSigningKeys(c *gin.Context) {
+	keys, err := models.GetSigningKeys()
+	if err != nil {
+		c.Set("error", err)
+		return
+	}
+	c.JSON(http.StatusOK, Response{Data: keys})
+}
+
+// RotateSigningKeys makes new keys sign tokens, tokens signed by previous keys stay valid until they expire.
+func RotateSigningKeys(c *gin.Context) {
+	if err := jwt.RotateKeys(); err != nil {
+		c.Set("error", errs.New(err))
+		return
+	}
+	c.Status(http.StatusOK)
 }
 
 func LogoutByJWT(c *gin.Context) {
-	id := c.GetString("user_id")
-	if err := auth.Revoke(id); err != nil {
+	id, _ := strconv.ParseInt(c.GetString("user_id"), 10, 64)
+	if err := jwt.Revoke(id); err != nil {
 		c.Set("error", errs.New(err))
 	}
 	c.Status(http.StatusOK)
 }
 
+// RefreshToken issues a new access token and a new refresh token, roles of user are loaded again.
+// A refresh token can only be used once, presenting it again revokes all refresh tokens since the same login.
+// User who is required to enable two-factor authentication since last login has to log in again.
 func RefreshToken(c *gin.Context) {
-	authHeader := c.Request.Header.Get("Authorization")
-	if authHeader == "" {
-		c.AbortWithStatus(http.StatusUnauthorized)
+	token, ok := jwt.BearerToken(c)
+	if !ok {
+		c.Set("error", errs.ErrInvalidAuthHeader)
+		return
+	}
+
+	claims, err := jwt.ValidateRefreshJWT(token)
+	if err != nil {
+		c.Set("error", err)
 		return
 	}
-	parts := strings.SplitN(authHeader, " ", 2)
-	if parts[0] != "Bearer" {
-		c.AbortWithStatus(http.StatusUnauthorized)
+	status, err := models.GetMFAStatus(claims.Id)
+	if err != nil {
+		c.Set("error", err)
 		return
 	}
-
-	token := parts[1]
-	id, err := auth.RefreshChecker(token)
+	if status.Required && !status.Enabled {
+		c.Set("error", errs.ErrMFARequired)
+		return
+	}
+	roles, err := models.GetUserRoles(claims.Id)
 	if err != nil {
-		c.AbortWithStatus(http.StatusUnauthorized)
+		c.Set("error", err)
 		return
 	}
-	accessToken, err := auth.CreateAccessToken(id.(string))
+	accessToken, err := jwt.GenerateAccessJWT(claims.Id, roles)
 	if err != nil {
 		c.Set("error", errs.New(err))
 		return
 	}
+	// rotate at last, so that the used token is not spent if the response fails.
+	refreshToken, err := jwt.RotateRefreshJWT(claims)
+	if err != nil {
+		c.Set("error", err)
+		return
+	}
 	c.JSON(http.StatusOK, Response{Data: gin.H{
-		"access_token": accessToken,
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
 	},
 	})
 
 }
 
+const headerQRSecret = "X-QR-Secret"
+
+// PollQRLogin waits until status of a QR login ticket differs from query "status", or until poll times out.
+// Header X-QR-Secret carries the secret which web client gets along with the ticket,
+// it is never put in URL, which may be written to access logs.
+// Once the ticket is confirmed, tokens are issued like LoginByJWT, otherwise the current status is returned.
+// Two-factor authentication is not asked again, since the ticket is confirmed by a user who has logged in.
+func PollQRLogin(c *gin.Context) {
+	ticket, secret, known := c.Param("ticket"), c.GetHeader(headerQRSecret), c.Query("status")
+	deadline := time.Now().Add(Config.QRPollTimeout)
+	for {
+		status, uid, err := cache.ConsumeQRTicket(ticket, secret)
+		if err != nil {
+			c.Set("error", err)
+			return
+		}
+		if status == cache.QRConfirmed {
+			if err = issueTokens(c, uid); err != nil {
+				c.Set("error", err)
+			}
+			return
+		}
+		if status != known || time.Now().After(deadline) {
+			c.JSON(http.StatusOK, Response{Data: gin.H{"status": status}})
+			return
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-time.After(qrPollInterval):
+		}
+	}
+}
+
+const qrPollInterval = 500 * time.Millisecond
+
+type passwordChangeRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+// ChangePassword changes password of the authenticated user.
+// All tokens and sessions issued before will be revoked, and current client will get new credentials.
+func ChangePassword(c *gin.Context) {
+	var (
+		req passwordChangeRequest
+		err error
+	)
+	defer func() { c.Set("error", err) }()
+
+	if err = api.BindJSON(c, &req); err != nil {
+		return
+	}
+
+	id := c.GetInt64("id")
+	if err = models.ChangePassword(id, req.OldPassword, req.NewPassword); err != nil {
+		return
+	}
+	if err = jwt.Revoke(id); err != nil {
+		err = errs.New(err)
+		return
+	}
+	if sid := c.GetString("session_id"); sid != "" {
+		cache.DeleteSession(sid)
+		err = startSession(c, id)
+		return
+	}
+	err = issueTokens(c, id)
+}
+
 /*
 	******************************************
 	*       Session-Based Authentication     *
     ******************************************
 */
 
-func LoginBySession() {
+// Login by email address or cellphone number, and keep login status in a cookie session.
+func LoginBySession(c *gin.Context) {
+	var (
+		user models.User
+		err  error
+	)
+	defer func() { c.Set("error", err) }()
+
+	if err = api.BindJSON(c, &user); err != nil {
+		return
+	}
+
+	if err = api.Login(c, &user); err != nil {
+		return
+	}
+
+	err = completeLogin(c, user.Id, startSession)
+}
+
+// LoginBySessionSMS logs in by a one-time code sent to cellphone, and keeps login status in a cookie session.
+func LoginBySessionSMS(c *gin.Context) {
+	user, err := api.LoginByOTP(c)
+	if err != nil {
+		c.Set("error", err)
+		return
+	}
+	if err = completeLogin(c, user.Id, startSession); err != nil {
+		c.Set("error", err)
+	}
+}
+
+// LoginBySessionWebAuthn logs in by a passkey, and keeps login status in a cookie session.
+func LoginBySessionWebAuthn(c *gin.Context) {
+	user, verified, err := api.LoginByPasskey(c)
+	if err != nil {
+		c.Set("error", err)
+		return
+	}
+	if verified {
+		err = startSession(c, user.Id)
+	} else {
+		err = completeLogin(c, user.Id, startSession)
+	}
+	if err != nil {
+		c.Set("error", err)
+	}
+}
+
+// LoginBySessionOAuth logs in by an external account at an OAuth provider, and keeps login status in a cookie session.
+func LoginBySessionOAuth(c *gin.Context) {
+	user, err := api.LoginByOAuth(c)
+	if err != nil {
+		c.Set("error", err)
+		return
+	}
+	if err = completeLogin(c, user.Id, startSession); err != nil {
+		c.Set("error", err)
+	}
+}
+
+// LoginBySessionMFA completes a login pending on two-factor authentication, and starts a session like LoginBySession.
+// Recovery codes are returned if user has just enrolled.
+func LoginBySessionMFA(c *gin.Context) {
+	var err error
+	defer func() { c.Set("error", err) }()
+
+	uid, codes, err := api.CompleteMFA(c)
+	if err != nil {
+		return
+	}
+	if err = createSession(c, uid); err != nil {
+		return
+	}
+	if codes != nil {
+		c.JSON(http.StatusOK, Response{Data: gin.H{"recovery_codes": codes}})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// startSession creates a session for user and writes its id to cookie.
+func startSession(c *gin.Context, uid int64) error {
+	if err := createSession(c, uid); err != nil {
+		return err
+	}
+	c.Status(http.StatusOK)
+	return nil
+}
 
+func createSession(c *gin.Context, uid int64) error {
+	roles, err := models.GetUserRoles(uid)
+	if err != nil {
+		return err
+	}
+	sid, err := cache.CreateSession(strconv.FormatInt(uid, 10), roles)
+	if err != nil {
+		return errs.New(err)
+	}
+	middleware.SetSessionCookie(c, sid)
+	return nil
 }
 
-func LogoutBySession() {
+func LogoutBySession(c *gin.Context) {
+	if err := cache.DeleteSession(c.GetString("session_id")); err != nil {
+		c.Set("error", errs.New(err))
+		return
+	}
+	middleware.ClearSessionCookie(c)
+	c.Status(http.StatusOK)
+}
 
+// Authenticator returns the authenticator of configured auth mode.
+// If both JWT and session are enabled, requests with an Authorization header are authenticated by JWT.
+func Authenticator() gin.HandlerFunc {
+	jwtAuthenticator := jwt.Authenticator()
+	sessionAuthenticator := middleware.SessionAuthenticator()
+	switch Config.AuthMode {
+	case AuthSession:
+		return sessionAuthenticator
+	case AuthBoth:
+		return func(c *gin.Context) {
+			if c.Request.Header.Get("Authorization") != "" {
+				jwtAuthenticator(c)
+			} else {
+				sessionAuthenticator(c)
+			}
+		}
+	default:
+		return jwtAuthenticator
+	}
 }
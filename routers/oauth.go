@@ -0,0 +1,188 @@
+package routers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/core/api"
+	. "github.com/go-pandora/core/conf"
+	"github.com/go-pandora/core/errs"
+	"github.com/go-pandora/core/middleware/jwt"
+	"github.com/go-pandora/core/models"
+	"net/http"
+	"strconv"
+)
+
+/*
+	*****************************************
+    *     OAuth 2.0 Authorization Server    *
+    *****************************************
+*/
+
+// IssueClientToken is the token endpoint of RFC 6749, which issues tokens to apps by
+// authorization code with PKCE, client credentials, or refresh token.
+// Refresh tokens are rotated, the old one is consumed atomically, so that it can only be used once.
+func IssueClientToken(c *gin.Context) {
+	client, err := api.AuthenticateClient(c)
+	if err != nil {
+		api.AbortOAuth(c, err)
+		return
+	}
+
+	var (
+		uid          int64
+		scope        string
+		refreshScope string // a refresh token is issued with it if not empty
+	)
+	switch c.PostForm("grant_type") {
+	case "authorization_code":
+		code, err := api.RedeemAuthorizationCode(c, client)
+		if err != nil {
+			api.AbortOAuth(c, err)
+			return
+		}
+		uid, scope, refreshScope = code.UserId, code.Scope, code.Scope
+	case "refresh_token":
+		claims, err := jwt.ValidateClientRefreshJWT(c.PostForm("refresh_token"))
+		if err != nil || claims.ClientId != client.ClientId {
+			api.AbortOAuth(c, api.ErrOAuthInvalidGrant)
+			return
+		}
+		// an app may ask for less scope than it has been granted.
+		scope = claims.Scope
+		if requested := c.PostForm("scope"); requested != "" {
+			if !models.CoversScope(claims.Scope, requested) {
+				api.AbortOAuth(c, api.ErrOAuthInvalidScope)
+				return
+			}
+			scope = requested
+		}
+		consumed, err := jwt.ConsumeClientToken(claims)
+		if err != nil {
+			c.Set("error", errs.New(err))
+			return
+		}
+		if !consumed {
+			api.AbortOAuth(c, api.ErrOAuthInvalidGrant)
+			return
+		}
+		uid, refreshScope = claims.Id, claims.Scope
+	case "client_credentials":
+		if !client.Confidential {
+			api.AbortOAuth(c, api.ErrOAuthUnauthorizedClient)
+			return
+		}
+		if scope, err = client.ParseScope(c.PostForm("scope")); err != nil {
+			api.AbortOAuth(c, api.ErrOAuthInvalidScope)
+			return
+		}
+	case "":
+		api.AbortOAuth(c, api.ErrOAuthInvalidRequest)
+		return
+	default:
+		api.AbortOAuth(c, api.ErrOAuthUnsupportedGrantType)
+		return
+	}
+
+	accessToken, err := jwt.GenerateClientAccessJWT(uid, client.ClientId, scope)
+	if err != nil {
+		c.Set("error", errs.New(err))
+		return
+	}
+	tokens := gin.H{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(Config.Timeout.Seconds()),
+		"scope":        scope,
+	}
+	if refreshScope != "" {
+		refreshToken, err := jwt.GenerateClientRefreshJWT(uid, client.ClientId, refreshScope)
+		if err != nil {
+			c.Set("error", errs.New(err))
+			return
+		}
+		tokens["refresh_token"] = refreshToken
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, tokens)
+}
+
+// IntrospectToken is the introspection endpoint of RFC 7662, which tells a confidential app, usually a
+// resource server, whether a token is active and what it carries.
+// Besides tokens issued to apps, access tokens of Pandora itself can also be introspected,
+// so that other services don't need to share the secret of JWT.
+func IntrospectToken(c *gin.Context) {
+	client, err := api.AuthenticateClient(c)
+	if err != nil {
+		api.AbortOAuth(c, err)
+		return
+	}
+	if !client.Confidential {
+		api.AbortOAuth(c, api.ErrOAuthUnauthorizedClient)
+		return
+	}
+	token := c.PostForm("token")
+	if token == "" {
+		api.AbortOAuth(c, api.ErrOAuthInvalidRequest)
+		return
+	}
+
+	tokenType := "access_token"
+	claims, err := jwt.ValidateAccessJWT(token)
+	if err != nil {
+		claims, err = jwt.ValidateClientAccessJWT(token)
+	}
+	if err != nil {
+		tokenType = "refresh_token"
+		claims, err = jwt.ValidateClientRefreshJWT(token)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"active": false})
+		return
+	}
+	info := gin.H{
+		"active":     true,
+		"token_type": tokenType,
+		"exp":        claims.ExpiresAt,
+		"iat":        claims.IssuedAt,
+		"iss":        claims.Issuer,
+	}
+	if claims.Id != 0 {
+		info["sub"] = strconv.FormatInt(claims.Id, 10)
+	}
+	if claims.ClientId != "" {
+		info["client_id"] = claims.ClientId
+		info["scope"] = claims.Scope
+		info["aud"] = claims.Audience
+		info["jti"] = claims.StandardClaims.Id
+	}
+	if len(claims.Roles) > 0 {
+		info["roles"] = claims.Roles
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// RevokeClientToken is the revocation endpoint of RFC 7009, which revokes an access token or a refresh token
+// issued to the app. It succeeds even if the token is invalid, since there is nothing left to revoke.
+func RevokeClientToken(c *gin.Context) {
+	client, err := api.AuthenticateClient(c)
+	if err != nil {
+		api.AbortOAuth(c, err)
+		return
+	}
+	token := c.PostForm("token")
+	if token == "" {
+		api.AbortOAuth(c, api.ErrOAuthInvalidRequest)
+		return
+	}
+
+	claims, err := jwt.ValidateClientRefreshJWT(token)
+	if err != nil {
+		claims, err = jwt.ValidateClientAccessJWT(token)
+	}
+	if err == nil && claims.ClientId == client.ClientId {
+		if err = jwt.RevokeClientToken(claims); err != nil {
+			c.Set("error", errs.New(err))
+			return
+		}
+	}
+	c.Status(http.StatusOK)
+}
@@ -6,34 +6,128 @@ import (
 	"github.com/go-pandora/core/api"
 	. "github.com/go-pandora/core/conf"
 	"github.com/go-pandora/core/middleware"
+	"github.com/go-pandora/core/middleware/jwt"
+	"github.com/go-pandora/core/models"
 )
 
 func SetRouter() (r *gin.Engine) {
 	r = gin.Default()
 	gin.SetMode(Config.RunMode)
-	r.Use(middleware.ErrHandler())
+	// gin believes X-Forwarded-For of anyone by default, RealIP only believes trusted proxies.
+	r.ForwardedByClientIP = false
+	r.Use(middleware.RealIP(), middleware.RequestId(), middleware.ErrHandler())
 
 	r.MaxMultipartMemory = 4 << 20
 	Upload := r.Group("/upload")
-	Upload.Use(auth.Authenticator())
+	Upload.Use(Authenticator())
 	{
-		Upload.POST("/avatar", api.UploadAvatar)
+		Upload.POST("/avatar", middleware.RateLimit("avatar"), api.UploadAvatar)
 	}
 
 	Auth := r.Group("/auth")
 	{
-		Auth.POST("/register", api.Register)
+		Auth.GET("/captcha", middleware.RateLimit("captcha"), api.GetCaptcha)
+		Auth.POST("/register", middleware.RateLimit("register"), middleware.RequireCaptcha(), api.Register)
+		Auth.GET("/activate", api.ActivateUser)
+		Auth.POST("/activate/resend", middleware.RateLimit("activation"), api.ResendActivation)
+		Auth.GET("/email/confirm", api.ConfirmEmailChange)
+		Auth.POST("/password/forgot", middleware.RateLimit("password_reset"), api.ForgotPassword)
+		Auth.POST("/password/reset", middleware.RateLimit("password_reset"), api.ResetPassword)
+		Auth.POST("/password/expired", middleware.RateLimit("mfa_login"), api.RenewExpiredPassword)
+		Auth.POST("/sms/code", middleware.RateLimit("sms"), api.SendLoginCode)
+		Auth.POST("/login/mfa/enroll", middleware.RateLimit("mfa_login"), api.EnrollPendingMFA)
+		Auth.POST("/webauthn/login/begin", middleware.RateLimit("webauthn"), api.BeginPasskeyLogin)
+		Auth.GET("/oauth/:provider", api.BeginOAuthLogin)
+	}
+	if Config.AuthMode != AuthSession {
 		Auth.POST("/login", LoginByJWT)
-		//Auth.GET("/activate", api.ActivateUser)
-		Auth.PUT("/logout", auth.Authenticator(), LogoutByJWT)
+		Auth.PUT("/logout", jwt.Authenticator(), LogoutByJWT)
 		Auth.GET("/refresh", RefreshToken)
+		Auth.POST("/sms/login", LoginBySMS)
+		Auth.POST("/login/mfa", middleware.RateLimit("mfa_login"), LoginByMFA)
+		Auth.POST("/webauthn/login", LoginByWebAuthn)
+		Auth.GET("/oauth/:provider/callback", LoginByOAuth)
+		Auth.POST("/oauth/:provider/login", LoginByOAuth)
+		Auth.POST("/qr", middleware.RateLimit("qr_login"), api.CreateQRLogin)
+		Auth.GET("/qr/:ticket", PollQRLogin)
+		Auth.PUT("/qr/:ticket/scan", jwt.Authenticator(), api.ScanQRLogin)
+		Auth.PUT("/qr/:ticket/confirm", jwt.Authenticator(), api.ConfirmQRLogin)
+	}
+	if Config.AuthMode != AuthJWT {
+		Auth.POST("/session/login", LoginBySession)
+		Auth.POST("/session/sms/login", LoginBySessionSMS)
+		Auth.POST("/session/login/mfa", middleware.RateLimit("mfa_login"), LoginBySessionMFA)
+		Auth.POST("/session/webauthn/login", LoginBySessionWebAuthn)
+		Auth.POST("/session/oauth/:provider/login", LoginBySessionOAuth)
+		if Config.AuthMode == AuthSession {
+			// provider redirects back to the same callback URL in either mode.
+			Auth.GET("/oauth/:provider/callback", LoginBySessionOAuth)
+		}
+		Auth.PUT("/session/logout", middleware.SessionAuthenticator(), LogoutBySession)
+	}
+
+	r.GET("/.well-known/jwks.json", GetJWKS)
+
+	OAuth := r.Group("/oauth")
+	{
+		OAuth.GET("/authorize", Authenticator(), api.GetAuthorizationRequest)
+		OAuth.POST("/authorize", Authenticator(), api.Authorize)
+		OAuth.POST("/token", middleware.RateLimit("oauth"), IssueClientToken)
+		OAuth.POST("/introspect", IntrospectToken)
+		OAuth.POST("/revoke", middleware.RateLimit("oauth"), RevokeClientToken)
 	}
 
 	Api := r.Group("/api")
-	Api.Use(middleware.IdValidator(), auth.Authenticator(), middleware.SimpleAuthorizer())
+	Api.Use(middleware.IdValidator(), Authenticator(), middleware.SimpleAuthorizer())
 	{
 		Api.GET("/user/:id", api.GetProfile)
 		Api.PUT("/user/:id", api.UpdateProfile)
+		Api.PUT("/user/:id/password", ChangePassword)
+		Api.PUT("/user/:id/cellphone/code", middleware.RateLimit("sms"), api.SendCellphoneCode)
+		Api.PUT("/user/:id/cellphone", api.ChangeCellphone)
+		Api.PUT("/user/:id/email", middleware.RateLimit("email"), api.RequestEmailChange)
+		Api.GET("/user/:id/mfa", middleware.RequireOwner(), api.GetMFAStatus)
+		Api.PUT("/user/:id/mfa", middleware.RequireOwner(), api.EnrollMFA)
+		Api.PUT("/user/:id/mfa/confirm", middleware.RequireOwner(), middleware.RateLimit("mfa"), api.ConfirmMFA)
+		Api.DELETE("/user/:id/mfa", middleware.RequireOwner(), middleware.RateLimit("mfa"), api.DisableMFA)
+		Api.GET("/user/:id/webauthn", middleware.RequireOwner(), api.GetPasskeys)
+		Api.PUT("/user/:id/webauthn/register/begin", middleware.RequireOwner(), api.BeginPasskeyRegistration)
+		Api.PUT("/user/:id/webauthn/register/finish", middleware.RequireOwner(), api.FinishPasskeyRegistration)
+		Api.DELETE("/user/:id/webauthn/:passkey", middleware.RequireOwner(), api.DeletePasskey)
+		Api.GET("/user/:id/oauth", middleware.RequireOwner(), api.GetIdentities)
+		Api.PUT("/user/:id/oauth/:provider", middleware.RequireOwner(), api.BeginOAuthLink)
+		Api.PUT("/user/:id/oauth/:provider/link", middleware.RequireOwner(), api.LinkOAuth)
+		Api.DELETE("/user/:id/oauth/:provider", middleware.RequireOwner(), api.UnlinkOAuth)
+		Api.GET("/user/:id/apps", middleware.RequireOwner(), api.GetAuthorizedApps)
+		Api.DELETE("/user/:id/apps/:client", middleware.RequireOwner(), api.RevokeAuthorizedApp)
+	}
+
+	Admin := r.Group("/admin")
+	Admin.Use(Authenticator())
+	{
+		Admin.GET("/roles", middleware.RequirePermission(models.PermRoleManage), api.GetRoles)
+		Admin.PUT("/roles/:role/mfa", middleware.RequirePermission(models.PermRoleManage), api.SetRoleMFA)
+		Admin.GET("/users", middleware.RequirePermission(models.PermUserRead), api.ListUsers)
+		Admin.GET("/clients", middleware.RequirePermission(models.PermClientManage), api.GetClients)
+		Admin.POST("/clients", middleware.RequirePermission(models.PermClientManage), api.AddClient)
+		Admin.DELETE("/clients/:client", middleware.RequirePermission(models.PermClientManage), api.DeleteClient)
+		Admin.PUT("/clients/:client/secret", middleware.RequirePermission(models.PermClientManage), api.ResetClientSecret)
+		Admin.GET("/keys", middleware.RequirePermission(models.PermKeyManage), GetSigningKeys)
+		Admin.PUT("/keys/rotate", middleware.RequirePermission(models.PermKeyManage), RotateSigningKeys)
+	}
+
+	AdminUser := Admin.Group("/users/:id")
+	AdminUser.Use(middleware.IdValidator())
+	{
+		AdminUser.GET("/roles", middleware.RequirePermission(models.PermRoleManage), api.GetUserRoles)
+		AdminUser.PUT("/roles/:role", middleware.RequirePermission(models.PermRoleManage), api.AssignRole)
+		AdminUser.DELETE("/roles/:role", middleware.RequirePermission(models.PermRoleManage), api.RevokeRole)
+		AdminUser.GET("/moderations", middleware.RequirePermission(models.PermUserModerate), api.GetModerations)
+		AdminUser.PUT("/restrict", middleware.RequirePermission(models.PermUserModerate), api.RestrictUser)
+		AdminUser.PUT("/ban", middleware.RequirePermission(models.PermUserModerate), api.BanUser)
+		AdminUser.PUT("/restore", middleware.RequirePermission(models.PermUserModerate), api.RestoreUser)
+		AdminUser.PUT("/activate", middleware.RequirePermission(models.PermUserModerate), api.ForceActivateUser)
+		AdminUser.DELETE("/lockout", middleware.RequirePermission(models.PermUserModerate), api.ClearLoginLockout)
 	}
 
 	return
@@ -0,0 +1,140 @@
+// Package captcha draws distorted digits into PNG images, without any font file or third-party service.
+package captcha
+
+import (
+	"bytes"
+	crand "crypto/rand"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"math/rand"
+)
+
+// font is a 5x7 bitmap of digits, the highest of 5 bits is the leftmost pixel of a row.
+var font = [10][7]uint8{
+	{0x0e, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0e},
+	{0x04, 0x0c, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	{0x0e, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1f},
+	{0x1f, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0e},
+	{0x02, 0x06, 0x0a, 0x12, 0x1f, 0x02, 0x02},
+	{0x1f, 0x10, 0x1e, 0x01, 0x01, 0x11, 0x0e},
+	{0x06, 0x08, 0x10, 0x1e, 0x11, 0x11, 0x0e},
+	{0x1f, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	{0x0e, 0x11, 0x11, 0x0e, 0x11, 0x11, 0x0e},
+	{0x0e, 0x11, 0x11, 0x0f, 0x01, 0x02, 0x0c},
+}
+
+const (
+	glyphWidth  = 5
+	glyphHeight = 7
+)
+
+// PNG draws digits into a PNG image of width x height.
+// Each digit is scaled, rotated and moved randomly, then the whole image is waved and covered by noise.
+func PNG(digits string, width, height int) ([]byte, error) {
+	rng, err := newRand()
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	background := color.RGBA{R: uint8(225 + rng.Intn(30)), G: uint8(225 + rng.Intn(30)), B: uint8(225 + rng.Intn(30)), A: 255}
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.ZP, draw.Src)
+
+	cell := float64(width) / float64(len(digits)+1)
+	for i, d := range digits {
+		if d < '0' || d > '9' {
+			continue
+		}
+		scale := float64(height) * (0.5 + rng.Float64()*0.15) / glyphHeight
+		cx := cell*(float64(i)+1) + (rng.Float64()-0.5)*cell*0.3
+		cy := float64(height)/2 + (rng.Float64()-0.5)*float64(height)*0.2
+		drawGlyph(img, font[d-'0'], cx, cy, scale, (rng.Float64()-0.5)*0.6, randomInk(rng))
+	}
+
+	img = wave(img, rng)
+	addNoise(img, rng)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// newRand creates a pseudo random generator for distortion, which is seeded securely
+// so that distortion of an image can't be predicted.
+func newRand() (*rand.Rand, error) {
+	var seed int64
+	if err := binary.Read(crand.Reader, binary.LittleEndian, &seed); err != nil {
+		return nil, err
+	}
+	return rand.New(rand.NewSource(seed)), nil
+}
+
+func randomInk(rng *rand.Rand) color.RGBA {
+	return color.RGBA{R: uint8(rng.Intn(120)), G: uint8(rng.Intn(120)), B: uint8(rng.Intn(120)), A: 255}
+}
+
+// drawGlyph draws glyph centered at (cx, cy), rotated by angle.
+// Every pixel around the center is mapped back into the glyph to see whether it should be painted.
+func drawGlyph(img *image.RGBA, glyph [glyphHeight]uint8, cx, cy, scale, angle float64, ink color.RGBA) {
+	sin, cos := math.Sincos(angle)
+	radius := int(math.Ceil(scale * glyphHeight))
+	for y := int(cy) - radius; y <= int(cy)+radius; y++ {
+		for x := int(cx) - radius; x <= int(cx)+radius; x++ {
+			dx, dy := float64(x)-cx, float64(y)-cy
+			gx := (dx*cos+dy*sin)/scale + glyphWidth/2.0
+			gy := (-dx*sin+dy*cos)/scale + glyphHeight/2.0
+			if gx < 0 || gy < 0 || gx >= glyphWidth || gy >= glyphHeight {
+				continue
+			}
+			if glyph[int(gy)]&(1<<uint(glyphWidth-1-int(gx))) != 0 && image.Pt(x, y).In(img.Rect) {
+				img.SetRGBA(x, y, ink)
+			}
+		}
+	}
+}
+
+// wave shifts rows and columns of img along sine curves.
+func wave(img *image.RGBA, rng *rand.Rand) *image.RGBA {
+	bounds := img.Bounds()
+	waved := image.NewRGBA(bounds)
+	amplitude := float64(bounds.Dy()) * (0.05 + rng.Float64()*0.05)
+	period := float64(bounds.Dx()) * (0.3 + rng.Float64()*0.3)
+	phaseX, phaseY := rng.Float64()*2*math.Pi, rng.Float64()*2*math.Pi
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			sx := x + int(amplitude*math.Sin(2*math.Pi*float64(y)/period+phaseX))
+			sy := y + int(amplitude*math.Sin(2*math.Pi*float64(x)/period+phaseY))
+			if !image.Pt(sx, sy).In(bounds) {
+				sx, sy = x, y
+			}
+			waved.SetRGBA(x, y, img.RGBAAt(sx, sy))
+		}
+	}
+	return waved
+}
+
+// addNoise draws random curves and dots over img.
+func addNoise(img *image.RGBA, rng *rand.Rand) {
+	bounds := img.Bounds()
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+	for i := 0; i < 3; i++ {
+		ink := randomInk(rng)
+		y0, amplitude := rng.Float64()*h, h*(0.1+rng.Float64()*0.2)
+		period, phase := w*(0.5+rng.Float64()), rng.Float64()*2*math.Pi
+		for x := 0.0; x < w; x += 0.5 {
+			y := y0 + amplitude*math.Sin(2*math.Pi*x/period+phase)
+			if p := image.Pt(bounds.Min.X+int(x), bounds.Min.Y+int(y)); p.In(bounds) {
+				img.SetRGBA(p.X, p.Y, ink)
+			}
+		}
+	}
+	for i := 0; i < bounds.Dx()*bounds.Dy()/30; i++ {
+		img.SetRGBA(bounds.Min.X+rng.Intn(bounds.Dx()), bounds.Min.Y+rng.Intn(bounds.Dy()), randomInk(rng))
+	}
+}
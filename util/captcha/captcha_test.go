@@ -0,0 +1,26 @@
+package captcha
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"image/png"
+	"testing"
+)
+
+func TestPNG(t *testing.T) {
+	data, err := PNG("0123456789", 240, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 240, img.Bounds().Dx())
+	assert.Equal(t, 60, img.Bounds().Dy())
+
+	// distortion is random, so the same digits should never look the same.
+	another, err := PNG("0123456789", 240, 60)
+	assert.Nil(t, err)
+	assert.NotEqual(t, data, another)
+}
@@ -0,0 +1,52 @@
+// Package cryptoutil encrypts secrets which are stored, e.g. signing keys in database.
+package cryptoutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"errors"
+	"github.com/go-pandora/core/util/randutil"
+)
+
+// ErrUnsealed means sealed data is corrupted, or it was sealed by another secret.
+var ErrUnsealed = errors.New("failed to open sealed data")
+
+// Seal encrypts plaintext by AES-256-GCM with a key derived from secret, the random nonce is prepended.
+func Seal(secret string, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(secret)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randutil.Bytes(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Open decrypts data sealed by Seal with the same secret.
+func Open(secret string, sealed []byte) ([]byte, error) {
+	aead, err := newAEAD(secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrUnsealed
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrUnsealed
+	}
+	return plaintext, nil
+}
+
+func newAEAD(secret string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,240 @@
+// Package jwk loads asymmetric keys which sign JWT from PEM files,
+// and publishes their public parts as JSON Web Keys (RFC 7517).
+package jwk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"io/ioutil"
+	"math/big"
+)
+
+var (
+	ErrInvalidPEM    = errors.New("jwk: no private key found in pem")
+	ErrKeyMismatch   = errors.New("jwk: key does not match signing algorithm")
+	ErrRSAKeyTooWeak = errors.New("jwk: rsa key must have at least 2048 bits")
+)
+
+// Key is a private key which signs JWT with its algorithm.
+type Key struct {
+	ID      string // kid, the JWK thumbprint of public key (RFC 7638)
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+}
+
+// Public returns the public key, which verifies JWT signed by k.
+func (k *Key) Public() crypto.PublicKey {
+	return k.Private.Public()
+}
+
+// JSONWebKey is the public part of a key.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// Set is a JWK Set, which is published at /.well-known/jwks.json.
+type Set struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// LoadPEM loads a private key for algorithm from a PEM file.
+func LoadPEM(file string, algorithm string) (*Key, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePEM(data, algorithm)
+}
+
+// ParsePEM parses a private key for algorithm, which is RS256, RS384, RS512, ES256, ES384, ES512 or EdDSA.
+// PKCS #8, PKCS #1 (RSA) and SEC 1 (EC) encodings are accepted.
+func ParsePEM(data []byte, algorithm string) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+	var private interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		private, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, ErrInvalidPEM
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	method := jwt.GetSigningMethod(algorithm)
+	if method == nil {
+		return nil, fmt.Errorf("jwk: unknown signing algorithm %s", algorithm)
+	}
+	switch private := private.(type) {
+	case *rsa.PrivateKey:
+		if _, ok := method.(*jwt.SigningMethodRSA); !ok {
+			return nil, ErrKeyMismatch
+		}
+		if private.N.BitLen() < 2048 {
+			return nil, ErrRSAKeyTooWeak
+		}
+	case *ecdsa.PrivateKey:
+		ecdsaMethod, ok := method.(*jwt.SigningMethodECDSA)
+		if !ok || ecdsaMethod.CurveBits != private.Curve.Params().BitSize {
+			return nil, ErrKeyMismatch
+		}
+	case ed25519.PrivateKey:
+		if method != SigningMethodEdDSA {
+			return nil, ErrKeyMismatch
+		}
+	default:
+		return nil, ErrKeyMismatch
+	}
+
+	key := &Key{Method: method, Private: private.(crypto.Signer)}
+	key.ID = Thumbprint(key.Public())
+	return key, nil
+}
+
+// Generate creates a private key for algorithm.
+func Generate(algorithm string) (*Key, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case "RS256", "RS384", "RS512":
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ES384":
+		private, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "ES512":
+		private, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case "EdDSA":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("jwk: unknown signing algorithm %s", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	key := &Key{Method: jwt.GetSigningMethod(algorithm), Private: private}
+	key.ID = Thumbprint(key.Public())
+	return key, nil
+}
+
+// PEM encodes private key of k in PKCS #8, which ParsePEM accepts.
+func (k *Key) PEM() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.Private)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// JWK returns the public part of k.
+func (k *Key) JWK() JSONWebKey {
+	jwk := publicJWK(k.Public())
+	jwk.Kid = k.ID
+	jwk.Use = "sig"
+	jwk.Alg = k.Method.Alg()
+	return jwk
+}
+
+// Thumbprint computes the JWK thumbprint of a public key by SHA-256 (RFC 7638).
+func Thumbprint(public crypto.PublicKey) string {
+	jwk := publicJWK(public)
+	// Only required members in lexicographic order are hashed, which json.Marshal does for maps.
+	members := map[string]string{"kty": jwk.Kty}
+	switch jwk.Kty {
+	case "RSA":
+		members["n"], members["e"] = jwk.N, jwk.E
+	case "EC":
+		members["crv"], members["x"], members["y"] = jwk.Crv, jwk.X, jwk.Y
+	case "OKP":
+		members["crv"], members["x"] = jwk.Crv, jwk.X
+	}
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// SecretThumbprint computes the JWK thumbprint of an HMAC secret, which identifies it without revealing it.
+func SecretThumbprint(secret []byte) string {
+	data, _ := json.Marshal(map[string]string{"k": encode(secret), "kty": "oct"})
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func publicJWK(public crypto.PublicKey) JSONWebKey {
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		return JSONWebKey{
+			Kty: "RSA",
+			N:   encode(public.N.Bytes()),
+			E:   encode(big.NewInt(int64(public.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		size := (public.Curve.Params().BitSize + 7) / 8
+		return JSONWebKey{
+			Kty: "EC",
+			Crv: curveName(public.Curve),
+			X:   encode(padded(public.X, size)),
+			Y:   encode(padded(public.Y, size)),
+		}
+	case ed25519.PublicKey:
+		return JSONWebKey{Kty: "OKP", Crv: "Ed25519", X: encode(public)}
+	default:
+		return JSONWebKey{}
+	}
+}
+
+func curveName(curve elliptic.Curve) string {
+	switch curve {
+	case elliptic.P256():
+		return "P-256"
+	case elliptic.P384():
+		return "P-384"
+	case elliptic.P521():
+		return "P-521"
+	default:
+		return ""
+	}
+}
+
+// padded returns n in big endian of size bytes, coordinates of EC keys must not be shortened.
+func padded(n *big.Int, size int) []byte {
+	b := n.Bytes()
+	if len(b) >= size {
+		return b
+	}
+	out := make([]byte, size)
+	copy(out[size-len(b):], b)
+	return out
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,110 @@
+package jwk
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+func pkcs8PEM(t *testing.T, key interface{}) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestParsePEM_SignAndVerify(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	cases := map[string][]byte{
+		"RS256": pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+		"ES256": pkcs8PEM(t, ecKey),
+		"EdDSA": pkcs8PEM(t, edKey),
+	}
+	for algorithm, data := range cases {
+		key, err := ParsePEM(data, algorithm)
+		if err != nil {
+			t.Fatal(algorithm, err)
+		}
+		token := jwt.NewWithClaims(key.Method, jwt.MapClaims{"id": 1})
+		token.Header["kid"] = key.ID
+		signed, err := token.SignedString(key.Private)
+		assert.Nil(t, err, algorithm)
+
+		parsed, err := jwt.Parse(signed, func(token *jwt.Token) (interface{}, error) {
+			return key.Public(), nil
+		})
+		assert.Nil(t, err, algorithm)
+		assert.True(t, parsed.Valid, algorithm)
+		assert.Equal(t, algorithm, parsed.Header["alg"])
+
+		jwk := key.JWK()
+		assert.Equal(t, key.ID, jwk.Kid)
+		assert.Equal(t, algorithm, jwk.Alg)
+		assert.Equal(t, "sig", jwk.Use)
+	}
+}
+
+func TestParsePEM_Mismatch(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	data := pkcs8PEM(t, ecKey)
+	_, err := ParsePEM(data, "ES256")
+	assert.Equal(t, ErrKeyMismatch, err)
+	_, err = ParsePEM(data, "RS256")
+	assert.Equal(t, ErrKeyMismatch, err)
+	_, err = ParsePEM(data, "ES384")
+	assert.Nil(t, err)
+
+	weak, _ := rsa.GenerateKey(rand.Reader, 1024)
+	_, err = ParsePEM(pkcs8PEM(t, weak), "RS256")
+	assert.Equal(t, ErrRSAKeyTooWeak, err)
+
+	_, err = ParsePEM([]byte("not a key"), "RS256")
+	assert.Equal(t, ErrInvalidPEM, err)
+}
+
+func TestGenerate(t *testing.T) {
+	for _, algorithm := range []string{"RS256", "ES256", "ES384", "ES512", "EdDSA"} {
+		key, err := Generate(algorithm)
+		if err != nil {
+			t.Fatal(algorithm, err)
+		}
+		data, err := key.PEM()
+		assert.Nil(t, err, algorithm)
+		parsed, err := ParsePEM(data, algorithm)
+		assert.Nil(t, err, algorithm)
+		assert.Equal(t, key.ID, parsed.ID, algorithm)
+	}
+	_, err := Generate("HS256")
+	assert.NotNil(t, err)
+}
+
+func TestEdDSA_RejectsTampered(t *testing.T) {
+	_, private, _ := ed25519.GenerateKey(rand.Reader)
+	signed, err := jwt.NewWithClaims(SigningMethodEdDSA, jwt.MapClaims{"id": 1}).SignedString(private)
+	assert.Nil(t, err)
+
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	_, err = jwt.Parse(signed, func(token *jwt.Token) (interface{}, error) {
+		return other, nil
+	})
+	assert.NotNil(t, err)
+}
+
+// TestThumbprint uses the example of RFC 7638, section 3.1.
+func TestThumbprint(t *testing.T) {
+	n, _ := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", Thumbprint(public))
+}
@@ -0,0 +1,183 @@
+package oauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ClockSkew is how much clocks of provider and server may differ.
+const ClockSkew = time.Minute
+
+// keyRefreshInterval limits how often keys are fetched again for an unknown kid,
+// so that forged tokens can't make server flood the provider.
+const keyRefreshInterval = time.Minute
+
+var errUnknownKey = errors.New("oauth: unknown signing key")
+
+// keySet caches JSON Web Keys of a provider by kid.
+type keySet struct {
+	mu      sync.Mutex
+	keys    map[string]interface{}
+	fetched time.Time
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// VerifyIDToken checks signature, issuer, audience, expiration and nonce of an ID token, and returns its claims.
+func (p *Provider) VerifyIDToken(raw string, nonce string) (map[string]interface{}, error) {
+	parser := &jwt.Parser{ValidMethods: []string{"RS256", "ES256"}, SkipClaimsValidation: true}
+	token, err := parser.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", ErrIDToken, err)
+	}
+	claims := token.Claims.(jwt.MapClaims)
+
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(ClockSkew)) {
+		return nil, fmt.Errorf("%s: expired", ErrIDToken)
+	}
+	if iat, ok := claims["iat"].(float64); ok && time.Unix(int64(iat), 0).After(now.Add(ClockSkew)) {
+		return nil, fmt.Errorf("%s: issued in the future", ErrIDToken)
+	}
+	if claims["iss"] != p.Issuer {
+		return nil, fmt.Errorf("%s: wrong issuer", ErrIDToken)
+	}
+	if !p.audienceValid(claims) {
+		return nil, fmt.Errorf("%s: wrong audience", ErrIDToken)
+	}
+	tokenNonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%s: wrong nonce", ErrIDToken)
+	}
+	return claims, nil
+}
+
+// audienceValid checks client is an audience of token, and the authorized party if there are others.
+func (p *Provider) audienceValid(claims jwt.MapClaims) bool {
+	var audience []string
+	switch aud := claims["aud"].(type) {
+	case string:
+		audience = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audience = append(audience, s)
+			}
+		}
+	}
+	found := false
+	for _, a := range audience {
+		found = found || a == p.ClientID
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != p.ClientID {
+		return false
+	}
+	return found
+}
+
+// key returns the public key of kid, keys are fetched again if kid is unknown.
+func (p *Provider) key(kid string) (interface{}, error) {
+	p.keysOnce.Do(func() { p.keys = &keySet{} })
+	set := p.keys
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	if key, ok := set.lookup(kid); ok {
+		return key, nil
+	}
+	if time.Since(set.fetched) < keyRefreshInterval {
+		return nil, errUnknownKey
+	}
+	keys, err := p.fetchKeys()
+	set.fetched = time.Now()
+	if err != nil {
+		return nil, err
+	}
+	set.keys = keys
+	if key, ok := set.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, errUnknownKey
+}
+
+// lookup finds key of kid, a token without kid can only be verified if there is only one key.
+func (s *keySet) lookup(kid string) (interface{}, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+func (p *Provider) fetchKeys() (map[string]interface{}, error) {
+	req, err := http.NewRequest(http.MethodGet, p.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err = p.do(req, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{})
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+func (k *jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+		if err1 != nil || err2 != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errUnknownKey
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		x, err1 := base64.RawURLEncoding.DecodeString(k.X)
+		y, err2 := base64.RawURLEncoding.DecodeString(k.Y)
+		if err1 != nil || err2 != nil || k.Crv != "P-256" {
+			return nil, errUnknownKey
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errUnknownKey
+		}
+		return key, nil
+	default:
+		return nil, errUnknownKey
+	}
+}
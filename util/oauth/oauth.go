@@ -0,0 +1,270 @@
+// Package oauth is a client of OAuth 2.0 authorization code flow with PKCE (RFC 7636),
+// which also verifies ID tokens of OpenID Connect. It works with any provider whose endpoints are known.
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrExchange = errors.New("oauth: failed to exchange code for token")
+	ErrUserInfo = errors.New("oauth: failed to get user info")
+	ErrIDToken  = errors.New("oauth: invalid id token")
+	ErrSubject  = errors.New("oauth: subject of user is missing")
+)
+
+// Client authentication methods at token endpoint.
+const (
+	AuthBasic = "basic" // client_secret_basic
+	AuthPost  = "post"  // client_secret_post
+)
+
+// Provider is an OAuth 2.0 authorization server, or an OpenID Connect provider if Issuer is set.
+type Provider struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	AuthStyle    string // basic or post
+	RedirectURL  string
+	Scopes       []string
+
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string // optional for OpenID Connect
+
+	Issuer  string // issuer of ID tokens, empty means the provider only speaks OAuth 2.0
+	JWKSURL string // keys which sign ID tokens
+
+	// Names of fields in user info, which differ between OAuth 2.0 providers.
+	// OpenID Connect standard claims are used by default.
+	SubjectField  string
+	EmailField    string
+	NameField     string
+	EmailVerified bool // trust emails of user info as verified, if provider only returns verified ones
+
+	HTTPClient *http.Client
+
+	keys     *keySet
+	keysOnce sync.Once
+}
+
+// Token is the response of token endpoint.
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	IDToken      string `json:"id_token"`
+}
+
+// Identity is who user is at the provider.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// NewPKCE returns a code verifier and its S256 challenge.
+func NewPKCE() (verifier string, challenge string, err error) {
+	if verifier, err = randomString(32); err != nil {
+		return "", "", err
+	}
+	return verifier, pkceChallenge(verifier), nil
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// NewState returns a random value for state or nonce.
+func NewState() (string, error) {
+	return randomString(32)
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthCodeURL returns where user is redirected to authorize.
+// nonce is only sent to OpenID Connect providers, and is checked in ID token.
+func (p *Provider) AuthCodeURL(state string, nonce string, challenge string) string {
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"state":                 {state},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+	if len(p.Scopes) > 0 {
+		query.Set("scope", strings.Join(p.Scopes, " "))
+	}
+	if p.Issuer != "" {
+		query.Set("nonce", nonce)
+	}
+	separator := "?"
+	if strings.Contains(p.AuthURL, "?") {
+		separator = "&"
+	}
+	return p.AuthURL + separator + query.Encode()
+}
+
+// Exchange redeems an authorization code with its PKCE verifier.
+func (p *Provider) Exchange(code string, verifier string) (*Token, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if p.AuthStyle == AuthPost {
+		form.Set("client_id", p.ClientID)
+		form.Set("client_secret", p.ClientSecret)
+	}
+	req, err := http.NewRequest(http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.AuthStyle != AuthPost {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	var token Token
+	if err = p.do(req, &token); err != nil {
+		return nil, fmt.Errorf("%s: %s", ErrExchange, err)
+	}
+	if token.AccessToken == "" {
+		return nil, ErrExchange
+	}
+	if p.Issuer != "" && token.IDToken == "" {
+		return nil, ErrIDToken
+	}
+	return &token, nil
+}
+
+// UserInfo returns claims of user from user info endpoint.
+func (p *Provider) UserInfo(accessToken string) (map[string]interface{}, error) {
+	req, err := http.NewRequest(http.MethodGet, p.UserInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	var claims map[string]interface{}
+	if err = p.do(req, &claims); err != nil {
+		return nil, fmt.Errorf("%s: %s", ErrUserInfo, err)
+	}
+	return claims, nil
+}
+
+// Identify finds out who user is with token.
+// For OpenID Connect, ID token is verified against nonce and user info can only add claims of the same subject.
+func (p *Provider) Identify(token *Token, nonce string) (*Identity, error) {
+	claims := make(map[string]interface{})
+	if p.Issuer != "" {
+		idClaims, err := p.VerifyIDToken(token.IDToken, nonce)
+		if err != nil {
+			return nil, err
+		}
+		claims = idClaims
+	}
+	if p.UserInfoURL != "" {
+		info, err := p.UserInfo(token.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+		if p.Issuer != "" && claimString(info, "sub") != claimString(claims, "sub") {
+			return nil, ErrUserInfo
+		}
+		for k, v := range info {
+			if _, ok := claims[k]; !ok {
+				claims[k] = v
+			}
+		}
+	}
+
+	identity := &Identity{
+		Subject: claimString(claims, field(p.SubjectField, "sub")),
+		Email:   claimString(claims, field(p.EmailField, "email")),
+		Name:    claimString(claims, field(p.NameField, "name")),
+	}
+	if identity.Subject == "" {
+		return nil, ErrSubject
+	}
+	// Some providers return email_verified as a string.
+	verified := claims["email_verified"] == true || claims["email_verified"] == "true"
+	identity.EmailVerified = identity.Email != "" && (verified || p.EmailVerified)
+	return identity, nil
+}
+
+func field(name string, fallback string) string {
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
+// claimString reads a claim as string, numbers are formatted as integers if possible, e.g. ids of GitHub.
+func claimString(claims map[string]interface{}, name string) string {
+	switch v := claims[name].(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		if v == float64(int64(v)) {
+			return fmt.Sprintf("%d", int64(v))
+		}
+		return fmt.Sprint(v)
+	default:
+		return ""
+	}
+}
+
+func (p *Provider) client() *http.Client {
+	if p.HTTPClient != nil {
+		return p.HTTPClient
+	}
+	return defaultClient
+}
+
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// do sends req and decodes JSON response into v.
+func (p *Provider) do(req *http.Request, v interface{}) error {
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, body)
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(body)))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
@@ -0,0 +1,215 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// mockProvider is an OpenID Connect provider which authorizes anyone as "alice".
+type mockProvider struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	codes  map[string]url.Values // authorization requests by code
+	claims jwt.MapClaims         // overrides claims of ID token
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockProvider{key: key, codes: make(map[string]url.Values), claims: jwt.MapClaims{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		code, _ := NewState()
+		m.codes[code] = r.URL.Query()
+		http.Redirect(w, r, r.URL.Query().Get("redirect_uri")+"?code="+code+"&state="+r.URL.Query().Get("state"), http.StatusFound)
+	})
+	mux.HandleFunc("/token", m.token)
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-alice" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"sub": "alice", "name": "Alice", "picture": "alice.png"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "mock",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	m.Server = httptest.NewServer(mux)
+	return m
+}
+
+func (m *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	request, known := m.codes[r.PostFormValue("code")]
+	delete(m.codes, r.PostFormValue("code"))
+	if !ok || id != "pandora" || secret != "secret" || !known ||
+		pkceChallenge(r.PostFormValue("code_verifier")) != request.Get("code_challenge") ||
+		r.PostFormValue("redirect_uri") != request.Get("redirect_uri") {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":            m.URL,
+		"sub":            "alice",
+		"aud":            "pandora",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          request.Get("nonce"),
+		"email":          "alice@example.com",
+		"email_verified": true,
+	}
+	for k, v := range m.claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "mock"
+	idToken, _ := token.SignedString(m.key)
+	json.NewEncoder(w).Encode(Token{AccessToken: "access-alice", TokenType: "Bearer", IDToken: idToken})
+}
+
+func (m *mockProvider) provider() *Provider {
+	return &Provider{
+		ClientID:     "pandora",
+		ClientSecret: "secret",
+		RedirectURL:  "https://pandora.example.com/oauth/callback",
+		Scopes:       []string{"openid", "email", "profile"},
+		AuthURL:      m.URL + "/authorize",
+		TokenURL:     m.URL + "/token",
+		UserInfoURL:  m.URL + "/userinfo",
+		Issuer:       m.URL,
+		JWKSURL:      m.URL + "/jwks",
+	}
+}
+
+// authorize follows authorization URL like a browser, and returns code and state sent to redirect URL.
+func authorize(t *testing.T, p *Provider, nonce string, challenge string) (string, string) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(p.AuthCodeURL("state", nonce, challenge))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestOpenIDConnect(t *testing.T) {
+	m := newMockProvider(t)
+	defer m.Close()
+	p := m.provider()
+
+	verifier, challenge, err := NewPKCE()
+	assert.Nil(t, err)
+	code, state := authorize(t, p, "nonce", challenge)
+	assert.Equal(t, "state", state)
+
+	token, err := p.Exchange(code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := p.Identify(token, "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &Identity{Subject: "alice", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}, identity)
+
+	// a code can only be redeemed once.
+	_, err = p.Exchange(code, verifier)
+	assert.NotNil(t, err)
+}
+
+func TestExchange_WrongVerifier(t *testing.T) {
+	m := newMockProvider(t)
+	defer m.Close()
+	p := m.provider()
+
+	_, challenge, _ := NewPKCE()
+	code, _ := authorize(t, p, "nonce", challenge)
+	another, _, _ := NewPKCE()
+	_, err := p.Exchange(code, another)
+	assert.NotNil(t, err)
+}
+
+func TestVerifyIDToken_Rejected(t *testing.T) {
+	cases := map[string]struct {
+		claims jwt.MapClaims
+		nonce  string
+	}{
+		"wrong nonce":    {jwt.MapClaims{}, "another nonce"},
+		"wrong audience": {jwt.MapClaims{"aud": "someone else"}, "nonce"},
+		"wrong issuer":   {jwt.MapClaims{"iss": "https://evil.example.com"}, "nonce"},
+		"expired":        {jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}, "nonce"},
+		"wrong azp":      {jwt.MapClaims{"aud": []string{"pandora", "other"}, "azp": "other"}, "nonce"},
+	}
+	for name, c := range cases {
+		m := newMockProvider(t)
+		m.claims = c.claims
+		p := m.provider()
+		verifier, challenge, _ := NewPKCE()
+		code, _ := authorize(t, p, "nonce", challenge)
+		token, err := p.Exchange(code, verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = p.Identify(token, c.nonce)
+		assert.NotNil(t, err, name)
+		m.Close()
+	}
+}
+
+func TestVerifyIDToken_UnknownKey(t *testing.T) {
+	m := newMockProvider(t)
+	defer m.Close()
+	p := m.provider()
+
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": m.URL, "sub": "alice", "aud": "pandora", "exp": time.Now().Add(time.Hour).Unix(), "nonce": "nonce",
+	})
+	token.Header["kid"] = "mock"
+	forged, _ := token.SignedString(other)
+	_, err := p.VerifyIDToken(forged, "nonce")
+	assert.NotNil(t, err)
+
+	// "none" must never be accepted.
+	token.Method = jwt.SigningMethodNone
+	token.Header["alg"] = "none"
+	unsigned, _ := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	_, err = p.VerifyIDToken(unsigned, "nonce")
+	assert.NotNil(t, err)
+}
+
+func TestIdentify_OAuth2(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": 583231, "login": "octocat", "email": "octocat@example.com"}`))
+	}))
+	defer server.Close()
+
+	p := &Provider{UserInfoURL: server.URL, SubjectField: "id", NameField: "login"}
+	identity, err := p.Identify(&Token{AccessToken: "token"}, "")
+	assert.Nil(t, err)
+	assert.Equal(t, &Identity{Subject: "583231", Email: "octocat@example.com", Name: "octocat"}, identity)
+}
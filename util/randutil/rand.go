@@ -0,0 +1,39 @@
+// Package randutil generates cryptographically secure random values.
+package randutil
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+)
+
+// Bytes returns n random bytes.
+func Bytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Token returns a random hex string generated from n random bytes.
+func Token(n int) (string, error) {
+	b, err := Bytes(n)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Digits returns a random numeric string with n digits.
+func Digits(n int) (string, error) {
+	b := make([]byte, n)
+	for i := range b {
+		d, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		b[i] = '0' + byte(d.Int64())
+	}
+	return string(b), nil
+}
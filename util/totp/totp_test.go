@@ -0,0 +1,61 @@
+package totp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test vectors of SHA1 in RFC 6238 appendix B.
+func TestHOTP_RFC6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+	cases := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+	for unix, code := range cases {
+		assert.Equal(t, code, hotp(key, Counter(time.Unix(unix, 0)), 8), "time %d", unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	code, err := Code(secret, now)
+	assert.Nil(t, err)
+	assert.Len(t, code, Digits)
+
+	step, ok := Validate(secret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, Counter(now), step)
+
+	// codes of adjacent periods are accepted for clock drift, but no further.
+	_, ok = Validate(secret, code, now.Add(Period))
+	assert.True(t, ok)
+	_, ok = Validate(secret, code, now.Add(3*Period))
+	assert.False(t, ok)
+
+	_, ok = Validate(secret, "abcdef", now)
+	assert.False(t, ok)
+	_, ok = Validate("not base32!", code, now)
+	assert.False(t, ok)
+
+	// secrets are accepted in lowercase or with spaces, as users may type them.
+	_, ok = Validate(strings.ToLower(secret[:4])+" "+secret[4:], code, now)
+	assert.True(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("JBSWY3DPEHPK3PXP", "Pandora", "miku@example.com")
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Pandora:miku@example.com?"))
+	assert.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	assert.Contains(t, uri, "issuer=Pandora")
+}
@@ -0,0 +1,91 @@
+package validation
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+)
+
+// BreachedList looks up passwords in a local list of breached passwords.
+// Each line of the list is an uppercase SHA-1 hash of a password, optionally followed by ":count",
+// and lines must be sorted by hash, which is the format of "ordered by hash" files of Pwned Passwords.
+// The list is searched on disk, so that even a huge list won't be loaded into memory.
+type BreachedList struct {
+	path string
+	size int64
+}
+
+func NewBreachedList(path string) (*BreachedList, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &BreachedList{path: path, size: info.Size()}, nil
+}
+
+// Contains checks whether password is in the list by binary search.
+func (b *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	target := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	file, err := os.Open(b.path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	// If target is in the list, its line starts in [lo, hi).
+	lo, hi := int64(0), b.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, line, err := lineAfter(file, mid)
+		if err != nil {
+			return false, err
+		}
+		if start >= hi {
+			hi = mid
+			continue
+		}
+
+		hash := strings.ToUpper(strings.TrimSpace(strings.SplitN(line, ":", 2)[0]))
+		switch {
+		case hash == target:
+			return true, nil
+		case hash < target:
+			lo = start + int64(len(line))
+		default:
+			hi = mid
+		}
+	}
+	return false, nil
+}
+
+// lineAfter returns the first line which starts at or after offset, including its line break.
+func lineAfter(file *os.File, offset int64) (int64, string, error) {
+	start := offset
+	if offset > 0 {
+		start = offset - 1
+	}
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		return 0, "", err
+	}
+	reader := bufio.NewReader(file)
+	if offset > 0 {
+		// Skip the rest of the line containing offset-1.
+		skipped, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return start + int64(len(skipped)), "", nil
+		} else if err != nil {
+			return 0, "", err
+		}
+		start += int64(len(skipped))
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, "", err
+	}
+	return start, line, nil
+}
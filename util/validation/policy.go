@@ -0,0 +1,104 @@
+package validation
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// Cellphone formats
+const (
+	CellphoneCN   = "cn"   // mainland China
+	CellphoneE164 = "e164" // international format, e.g. +8613312345678
+	CellphoneAny  = "any"  // either of above
+)
+
+// Policy specifies what valid information looks like.
+type Policy struct {
+	UsernameMinLength int
+	UsernameMaxLength int
+
+	PasswordMinLength int
+	PasswordMaxLength int
+	PasswordSymbols   string // symbols allowed in password besides letters and digits
+	RequireLower      bool
+	RequireUpper      bool
+	RequireDigit      bool
+	RequireSymbol     bool
+	DictionaryFile    string // common passwords, one per line
+	BreachedFile      string // SHA-1 hashes of breached passwords, see BreachedList
+
+	CellphoneFormat string
+
+	dictionary map[string]struct{}
+	breached   *BreachedList
+}
+
+// DefaultPolicy is used until SetPolicy is called.
+var DefaultPolicy = Policy{
+	UsernameMinLength: 4,
+	UsernameMaxLength: 16,
+	PasswordMinLength: 8,
+	PasswordMaxLength: 16,
+	PasswordSymbols:   "_~@#$^",
+	CellphoneFormat:   CellphoneCN,
+}
+
+var policy = DefaultPolicy
+
+// SetPolicy replaces the current policy, unset fields fall back to DefaultPolicy.
+// Dictionary and breached password list are loaded from files.
+func SetPolicy(p Policy) error {
+	if p.UsernameMinLength <= 0 {
+		p.UsernameMinLength = DefaultPolicy.UsernameMinLength
+	}
+	if p.UsernameMaxLength <= 0 {
+		p.UsernameMaxLength = DefaultPolicy.UsernameMaxLength
+	}
+	if p.PasswordMinLength <= 0 {
+		p.PasswordMinLength = DefaultPolicy.PasswordMinLength
+	}
+	if p.PasswordMaxLength <= 0 {
+		p.PasswordMaxLength = DefaultPolicy.PasswordMaxLength
+	}
+	if p.PasswordSymbols == "" {
+		p.PasswordSymbols = DefaultPolicy.PasswordSymbols
+	}
+	if p.CellphoneFormat == "" {
+		p.CellphoneFormat = DefaultPolicy.CellphoneFormat
+	}
+
+	if p.DictionaryFile != "" {
+		dictionary, err := loadDictionary(p.DictionaryFile)
+		if err != nil {
+			return err
+		}
+		p.dictionary = dictionary
+	}
+	if p.BreachedFile != "" {
+		breached, err := NewBreachedList(p.BreachedFile)
+		if err != nil {
+			return err
+		}
+		p.breached = breached
+	}
+	policy = p
+	return nil
+}
+
+func loadDictionary(path string) (map[string]struct{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	dictionary := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if word := strings.TrimSpace(scanner.Text()); word != "" {
+			dictionary[strings.ToLower(word)] = struct{}{}
+		}
+	}
+	return dictionary, scanner.Err()
+}
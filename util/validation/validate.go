@@ -1,43 +1,143 @@
+// Package validation validates user's information according to a configurable policy.
+// Besides the built-in policy, custom rules can be added for each field.
 package validation
 
 import (
 	"errors"
-	"fmt"
+	"log"
 	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
-func ValidateUsername(username string) error {
-	re, _ := regexp.Compile(`^\w{4,16}$`)
-	if !re.MatchString(username) {
-		return errors.New("username is invalid")
+var (
+	ErrInvalidUsername  = errors.New("username is invalid")
+	ErrInvalidPassword  = errors.New("password is invalid")
+	ErrInvalidEmail     = errors.New("email address is invalid")
+	ErrInvalidCellphone = errors.New("cellphone number is invalid")
+
+	ErrPasswordTooWeak          = errors.New("password does not contain required kinds of characters")
+	ErrPasswordTooCommon        = errors.New("password is too common")
+	ErrPasswordBreached         = errors.New("password has appeared in a data breach")
+	ErrPasswordContainsUsername = errors.New("password contains username")
+)
+
+// Fields which custom rules can be added to.
+const (
+	FieldUsername  = "username"
+	FieldPassword  = "password"
+	FieldEmail     = "email"
+	FieldCellphone = "cellphone"
+)
+
+// Rule validates a value, and returns an error if it is invalid.
+type Rule func(value string) error
+
+var rules = map[string][]Rule{}
+
+// AddRule adds a custom rule to field, which will be checked after the built-in policy.
+func AddRule(field string, rule Rule) {
+	rules[field] = append(rules[field], rule)
+}
+
+func checkRules(field string, value string) error {
+	for _, rule := range rules[field] {
+		if err := rule(value); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func ValidatePassword(password string) error {
-	//re, err := regexp.Compile(`^(?!\d+$)(?![a-zA-Z]+$)(?![_~@#$^]+$)[\w~@#$^]{8,16}$`)
-	re, err := regexp.Compile(`^[\w~@#$^]{8,16}$`)
-	if err != nil {
-		fmt.Println(err)
+// ValidateUsername checks length of username, which may contain letters and digits of any language and "_".
+func ValidateUsername(username string) error {
+	length := utf8.RuneCountInString(username)
+	if length < policy.UsernameMinLength || length > policy.UsernameMaxLength {
+		return ErrInvalidUsername
 	}
-	if !re.MatchString(password) {
-		return errors.New("password is invalid")
+	for _, r := range username {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r) && r != '_' {
+			return ErrInvalidUsername
+		}
 	}
-	return nil
+	return checkRules(FieldUsername, username)
+}
+
+// ValidatePassword checks password against the password policy.
+// If username is provided, password must not contain it.
+func ValidatePassword(password string, username ...string) error {
+	length := utf8.RuneCountInString(password)
+	if length < policy.PasswordMinLength || length > policy.PasswordMaxLength {
+		return ErrInvalidPassword
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case 'a' <= r && r <= 'z':
+			lower = true
+		case 'A' <= r && r <= 'Z':
+			upper = true
+		case '0' <= r && r <= '9':
+			digit = true
+		case strings.ContainsRune(policy.PasswordSymbols, r):
+			symbol = true
+		default:
+			return ErrInvalidPassword
+		}
+	}
+	if (policy.RequireLower && !lower) || (policy.RequireUpper && !upper) ||
+		(policy.RequireDigit && !digit) || (policy.RequireSymbol && !symbol) {
+		return ErrPasswordTooWeak
+	}
+
+	for _, name := range username {
+		if utf8.RuneCountInString(name) >= 3 && strings.Contains(strings.ToLower(password), strings.ToLower(name)) {
+			return ErrPasswordContainsUsername
+		}
+	}
+	if _, ok := policy.dictionary[strings.ToLower(password)]; ok {
+		return ErrPasswordTooCommon
+	}
+	if policy.breached != nil {
+		// The list is an extra safeguard, so a broken list file should not stop users from setting passwords.
+		if breached, err := policy.breached.Contains(password); err != nil {
+			log.Printf("failed to look up breached passwords: %s", err)
+		} else if breached {
+			return ErrPasswordBreached
+		}
+	}
+	return checkRules(FieldPassword, password)
 }
 
+var emailRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]+@[a-zA-Z0-9-]+(\.[a-zA-Z0-9-]+)*\.[a-zA-Z]{2,6}$`)
+
 func ValidateEmail(email string) error {
-	re, _ := regexp.Compile(`^[a-zA-Z0-9_.-]+@[a-zA-Z0-9-]+(\.[a-zA-Z0-9-]+)*\.[a-zA-Z]{2,6}$`)
-	if !re.MatchString(email) {
-		return errors.New("email address is invalid")
+	if !emailRegexp.MatchString(email) {
+		return ErrInvalidEmail
 	}
-	return nil
+	return checkRules(FieldEmail, email)
 }
 
+var (
+	cnCellphoneRegexp = regexp.MustCompile(`^1(3[0-9]|4[579]|5[0-3,5-9]|6[6]|7[0135678]|8[0-9]|9[89])\d{8}$`)
+	e164Regexp        = regexp.MustCompile(`^\+[1-9]\d{6,14}$`)
+)
+
+// ValidateCellphone checks cellphone number according to the configured format.
 func ValidateCellphone(cellphone string) error {
-	re, _ := regexp.Compile(`^1(3[0-9]|4[579]|5[0-3,5-9]|6[6]|7[0135678]|8[0-9]|9[89])\d{8}$`)
-	if !re.MatchString(cellphone) {
-		return errors.New("cellphone number is invalid")
+	var valid bool
+	switch policy.CellphoneFormat {
+	case CellphoneE164:
+		valid = e164Regexp.MatchString(cellphone)
+	case CellphoneAny:
+		valid = cnCellphoneRegexp.MatchString(cellphone) || e164Regexp.MatchString(cellphone)
+	default:
+		valid = cnCellphoneRegexp.MatchString(cellphone)
 	}
-	return nil
+	if !valid {
+		return ErrInvalidCellphone
+	}
+	return checkRules(FieldCellphone, cellphone)
 }
@@ -0,0 +1,93 @@
+package validation
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, dir string, name string, lines []string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestValidatePassword(t *testing.T) {
+	dir, err := ioutil.TempDir("", "validation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer SetPolicy(DefaultPolicy)
+
+	var hashes []string
+	for _, password := range []string{"Breached1", "Password1", "Qwerty123", "Letmein99", "Dragon777"} {
+		sum := sha1.Sum([]byte(password))
+		hashes = append(hashes, strings.ToUpper(hex.EncodeToString(sum[:]))+":42")
+	}
+	sort.Strings(hashes)
+
+	assert := assert.New(t)
+	assert.NoError(SetPolicy(Policy{
+		RequireLower:   true,
+		RequireUpper:   true,
+		RequireDigit:   true,
+		DictionaryFile: writeFile(t, dir, "dictionary.txt", []string{"Iloveyou1"}),
+		BreachedFile:   writeFile(t, dir, "breached.txt", hashes),
+	}))
+
+	assert.Equal(ErrInvalidPassword, ValidatePassword("Short1"))
+	assert.Equal(ErrInvalidPassword, ValidatePassword("Pandora123&"))
+	assert.Equal(ErrPasswordTooWeak, ValidatePassword("pandora123"))
+	assert.Equal(ErrPasswordContainsUsername, ValidatePassword("MikuChan39", "miku"))
+	assert.Equal(ErrPasswordTooCommon, ValidatePassword("iLoveYou1"))
+	for _, password := range []string{"Breached1", "Password1", "Qwerty123", "Letmein99", "Dragon777"} {
+		assert.Equal(ErrPasswordBreached, ValidatePassword(password))
+	}
+	assert.NoError(ValidatePassword("Pandora2019"))
+}
+
+func TestValidateUsername(t *testing.T) {
+	assert := assert.New(t)
+	assert.NoError(ValidateUsername("初音未来"))
+	assert.NoError(ValidateUsername("Miku_39"))
+	assert.Equal(ErrInvalidUsername, ValidateUsername("Miku 39"))
+	assert.Equal(ErrInvalidUsername, ValidateUsername("未来"))
+}
+
+func TestValidateCellphone(t *testing.T) {
+	defer SetPolicy(DefaultPolicy)
+
+	assert := assert.New(t)
+	assert.NoError(ValidateCellphone("13312345678"))
+	assert.Equal(ErrInvalidCellphone, ValidateCellphone("+8613312345678"))
+
+	assert.NoError(SetPolicy(Policy{CellphoneFormat: CellphoneE164}))
+	assert.NoError(ValidateCellphone("+8613312345678"))
+	assert.Equal(ErrInvalidCellphone, ValidateCellphone("13312345678"))
+
+	assert.NoError(SetPolicy(Policy{CellphoneFormat: CellphoneAny}))
+	assert.NoError(ValidateCellphone("+14155552671"))
+	assert.NoError(ValidateCellphone("13312345678"))
+}
+
+func TestAddRule(t *testing.T) {
+	defer delete(rules, FieldEmail)
+
+	AddRule(FieldEmail, func(email string) error {
+		if strings.HasSuffix(email, "@example.com") {
+			return ErrInvalidEmail
+		}
+		return nil
+	})
+	assert.Equal(t, ErrInvalidEmail, ValidateEmail("miku@example.com"))
+	assert.NoError(t, ValidateEmail("miku@pandora.com"))
+}
@@ -0,0 +1,105 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// COSE algorithms supported, which cover almost all authenticators.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// Algorithms lists supported algorithms in order of preference, which are offered to authenticators.
+var Algorithms = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+var (
+	ErrUnsupportedKey = errors.New("webauthn: unsupported public key")
+	ErrInvalidSig     = errors.New("webauthn: invalid signature")
+)
+
+// COSE key parameters of RFC 8152.
+const (
+	coseKty = 1
+	coseAlg = 3
+	coseCrv = -1 // n of RSA
+	coseX   = -2 // e of RSA
+	coseY   = -3
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+// publicKey is a credential public key decoded from COSE.
+type publicKey struct {
+	alg int
+	key crypto.PublicKey
+}
+
+// parsePublicKey decodes a COSE key, and returns the rest of data after it.
+func parsePublicKey(data []byte) (*publicKey, []byte, error) {
+	item, rest, err := decodeCBOR(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, nil, ErrUnsupportedKey
+	}
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+	crv, _ := m[int64(coseCrv)].(int64)
+	x, _ := m[int64(coseX)].([]byte)
+	y, _ := m[int64(coseY)].([]byte)
+
+	switch {
+	case kty == ktyEC2 && alg == AlgES256 && crv == crvP256 && len(x) == 32 && len(y) == 32:
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, nil, ErrUnsupportedKey
+		}
+		return &publicKey{alg: AlgES256, key: key}, rest, nil
+	case kty == ktyOKP && alg == AlgEdDSA && crv == crvEd25519 && len(x) == ed25519.PublicKeySize:
+		return &publicKey{alg: AlgEdDSA, key: ed25519.PublicKey(x)}, rest, nil
+	case kty == ktyRSA && alg == AlgRS256:
+		n, _ := m[int64(coseCrv)].([]byte)
+		e := new(big.Int).SetBytes(x)
+		if len(n) < 256 || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, nil, ErrUnsupportedKey
+		}
+		return &publicKey{alg: AlgRS256, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(e.Int64())}}, rest, nil
+	default:
+		return nil, nil, ErrUnsupportedKey
+	}
+}
+
+// verify checks signature of data.
+func (k *publicKey) verify(data []byte, signature []byte) error {
+	ok := false
+	switch k.alg {
+	case AlgES256:
+		digest := sha256.Sum256(data)
+		ok = ecdsa.VerifyASN1(k.key.(*ecdsa.PublicKey), digest[:], signature)
+	case AlgEdDSA:
+		ok = ed25519.Verify(k.key.(ed25519.PublicKey), data, signature)
+	case AlgRS256:
+		digest := sha256.Sum256(data)
+		ok = rsa.VerifyPKCS1v15(k.key.(*rsa.PublicKey), crypto.SHA256, digest[:], signature) == nil
+	}
+	if !ok {
+		return ErrInvalidSig
+	}
+	return nil
+}
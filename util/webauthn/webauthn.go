@@ -0,0 +1,259 @@
+// Package webauthn verifies registration and authentication ceremonies of Web Authentication (WebAuthn Level 2).
+// Attestation is not used to decide whether an authenticator is trusted, so relying parties should ask for "none".
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrInvalidClientData  = errors.New("webauthn: invalid client data")
+	ErrChallengeMismatch  = errors.New("webauthn: challenge mismatch")
+	ErrOriginMismatch     = errors.New("webauthn: origin not allowed")
+	ErrInvalidAuthData    = errors.New("webauthn: invalid authenticator data")
+	ErrRPIDMismatch       = errors.New("webauthn: rp id mismatch")
+	ErrUserNotPresent     = errors.New("webauthn: user not present")
+	ErrUserNotVerified    = errors.New("webauthn: user not verified")
+	ErrInvalidAttestation = errors.New("webauthn: invalid attestation")
+	ErrSignCount          = errors.New("webauthn: sign count did not increase, authenticator may be cloned")
+)
+
+// Flags of authenticator data.
+const (
+	FlagUserPresent  = 0x01
+	FlagUserVerified = 0x04
+	FlagAttested     = 0x40
+	FlagExtensions   = 0x80
+)
+
+// RelyingParty is the website which credentials are scoped to.
+type RelyingParty struct {
+	ID      string   // a domain, e.g. example.com
+	Name    string   // shown by authenticators
+	Origins []string // where ceremonies can be made, e.g. https://example.com
+
+	// RequireUserVerification rejects authenticators which don't verify user by PIN or biometrics.
+	RequireUserVerification bool
+}
+
+// Credential is a public key credential created by an authenticator.
+type Credential struct {
+	ID           []byte
+	PublicKey    []byte // COSE encoded
+	SignCount    uint32
+	AAGUID       []byte // model of authenticator, all zeros if attestation is "none"
+	UserVerified bool
+}
+
+// Assertion is the result of a successful authentication.
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+type authenticatorData struct {
+	rpIDHash   []byte
+	flags      byte
+	signCount  uint32
+	credential *Credential
+	key        *publicKey
+}
+
+// NewChallenge wraps random bytes into what browsers expect as a challenge.
+func NewChallenge(random []byte) string {
+	return EncodeBase64(random)
+}
+
+// EncodeBase64 encodes binary fields like credential ids as browsers do.
+func EncodeBase64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeBase64 decodes base64url as browsers encode binary fields, with or without padding.
+func DecodeBase64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// VerifyRegistration verifies response of navigator.credentials.create() to challenge,
+// and returns the new credential to be stored for user.
+func (rp *RelyingParty) VerifyRegistration(challenge string, clientDataJSON []byte, attestationObject []byte) (*Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	item, rest, err := decodeCBOR(attestationObject)
+	if err != nil || len(rest) != 0 {
+		return nil, ErrInvalidAttestation
+	}
+	object, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrInvalidAttestation
+	}
+	format, _ := object["fmt"].(string)
+	statement, _ := object["attStmt"].(map[interface{}]interface{})
+	rawAuthData, _ := object["authData"].([]byte)
+
+	authData, err := rp.verifyAuthData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.credential == nil {
+		return nil, ErrInvalidAuthData
+	}
+	if err = verifyAttestation(format, statement, authData, rawAuthData, clientDataJSON); err != nil {
+		return nil, err
+	}
+	return authData.credential, nil
+}
+
+// VerifyAssertion verifies response of navigator.credentials.get() to challenge,
+// which is signed by credential with publicKey. signCount is the stored counter of credential.
+func (rp *RelyingParty) VerifyAssertion(challenge string, publicKey []byte, signCount uint32,
+	clientDataJSON []byte, rawAuthData []byte, signature []byte) (*Assertion, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+	authData, err := rp.verifyAuthData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	key, _, err := parsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if err = key.verify(signedData(rawAuthData, clientDataJSON), signature); err != nil {
+		return nil, err
+	}
+	// Authenticators which don't count always return zero.
+	if (authData.signCount != 0 || signCount != 0) && authData.signCount <= signCount {
+		return nil, ErrSignCount
+	}
+	return &Assertion{SignCount: authData.signCount, UserVerified: authData.flags&FlagUserVerified != 0}, nil
+}
+
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, ceremony string, challenge string) error {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return ErrInvalidClientData
+	}
+	if data.Type != ceremony || data.CrossOrigin {
+		return ErrInvalidClientData
+	}
+	if subtle.ConstantTimeCompare([]byte(strings.TrimRight(data.Challenge, "=")), []byte(challenge)) != 1 {
+		return ErrChallengeMismatch
+	}
+	for _, origin := range rp.Origins {
+		if data.Origin == origin {
+			return nil
+		}
+	}
+	return ErrOriginMismatch
+}
+
+// verifyAuthData parses authenticator data and checks it is made for this relying party.
+func (rp *RelyingParty) verifyAuthData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, ErrInvalidAuthData
+	}
+	authData := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.rpIDHash, rpIDHash[:]) {
+		return nil, ErrRPIDMismatch
+	}
+	if authData.flags&FlagUserPresent == 0 {
+		return nil, ErrUserNotPresent
+	}
+	verified := authData.flags&FlagUserVerified != 0
+	if rp.RequireUserVerification && !verified {
+		return nil, ErrUserNotVerified
+	}
+
+	rest := data[37:]
+	if authData.flags&FlagAttested != 0 {
+		// attested credential data: aaguid (16), length of credential id (2), credential id, COSE key
+		if len(rest) < 18 {
+			return nil, ErrInvalidAuthData
+		}
+		aaguid, idLength := rest[:16], int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength == 0 || len(rest) < idLength {
+			return nil, ErrInvalidAuthData
+		}
+		id := rest[:idLength]
+		key, after, err := parsePublicKey(rest[idLength:])
+		if err != nil {
+			return nil, err
+		}
+		authData.key = key
+		authData.credential = &Credential{
+			ID:           append([]byte(nil), id...),
+			PublicKey:    append([]byte(nil), rest[idLength:len(rest)-len(after)]...),
+			SignCount:    authData.signCount,
+			AAGUID:       append([]byte(nil), aaguid...),
+			UserVerified: verified,
+		}
+		rest = after
+	}
+	if authData.flags&FlagExtensions != 0 {
+		var err error
+		if _, rest, err = decodeCBOR(rest); err != nil {
+			return nil, ErrInvalidAuthData
+		}
+	}
+	if len(rest) != 0 {
+		return nil, ErrInvalidAuthData
+	}
+	return authData, nil
+}
+
+// verifyAttestation checks attestation statement as far as it proves the credential key.
+// Self attestation of "packed" is verified, while certificates of other formats are not checked,
+// which is the same as "none" since attestation is not used for trust.
+func verifyAttestation(format string, statement map[interface{}]interface{}, authData *authenticatorData,
+	rawAuthData []byte, clientDataJSON []byte) error {
+	switch format {
+	case "none":
+		if len(statement) != 0 {
+			return ErrInvalidAttestation
+		}
+		return nil
+	case "packed":
+		if _, ok := statement["x5c"]; ok {
+			return nil
+		}
+		alg, _ := statement["alg"].(int64)
+		sig, _ := statement["sig"].([]byte)
+		if int(alg) != authData.key.alg {
+			return ErrInvalidAttestation
+		}
+		return authData.key.verify(signedData(rawAuthData, clientDataJSON), sig)
+	case "fido-u2f", "tpm", "android-key", "android-safetynet", "apple":
+		return nil
+	default:
+		return ErrInvalidAttestation
+	}
+}
+
+// signedData is what authenticators sign: authenticator data followed by hash of client data.
+func signedData(rawAuthData []byte, clientDataJSON []byte) []byte {
+	hash := sha256.Sum256(clientDataJSON)
+	return append(append([]byte(nil), rawAuthData...), hash[:]...)
+}
@@ -0,0 +1,260 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+)
+
+// encodeCBOR encodes the few types authenticators use, with map keys sorted like CTAP2 canonical form.
+func encodeCBOR(v interface{}) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n < 1<<8:
+			return []byte{major<<5 | 24, byte(n)}
+		case n < 1<<16:
+			b := []byte{major<<5 | 25, 0, 0}
+			binary.BigEndian.PutUint16(b[1:], uint16(n))
+			return b
+		default:
+			b := []byte{major<<5 | 26, 0, 0, 0, 0}
+			binary.BigEndian.PutUint32(b[1:], uint32(n))
+			return b
+		}
+	}
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case map[interface{}]interface{}:
+		var keys [][]byte
+		values := make(map[string][]byte)
+		for k, value := range v {
+			key := encodeCBOR(k)
+			keys = append(keys, key)
+			values[string(key)] = encodeCBOR(value)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) {
+				return len(keys[i]) < len(keys[j])
+			}
+			return string(keys[i]) < string(keys[j])
+		})
+		b := head(5, uint64(len(v)))
+		for _, key := range keys {
+			b = append(append(b, key...), values[string(key)]...)
+		}
+		return b
+	}
+	panic("unsupported type")
+}
+
+// authenticator is a software authenticator, which does what a security key does.
+type authenticator struct {
+	id        []byte
+	ecKey     *ecdsa.PrivateKey
+	edKey     ed25519.PrivateKey
+	signCount uint32
+	flags     byte
+}
+
+func newAuthenticator(t *testing.T, eddsa bool) *authenticator {
+	a := &authenticator{id: make([]byte, 16), flags: FlagUserPresent | FlagUserVerified}
+	rand.Read(a.id)
+	var err error
+	if eddsa {
+		_, a.edKey, err = ed25519.GenerateKey(rand.Reader)
+	} else {
+		a.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func (a *authenticator) coseKey() []byte {
+	if a.edKey != nil {
+		return encodeCBOR(map[interface{}]interface{}{
+			coseKty: ktyOKP, coseAlg: AlgEdDSA, coseCrv: crvEd25519, coseX: []byte(a.edKey.Public().(ed25519.PublicKey)),
+		})
+	}
+	x, y := make([]byte, 32), make([]byte, 32)
+	a.ecKey.X.FillBytes(x)
+	a.ecKey.Y.FillBytes(y)
+	return encodeCBOR(map[interface{}]interface{}{
+		coseKty: ktyEC2, coseAlg: AlgES256, coseCrv: crvP256, coseX: x, coseY: y,
+	})
+}
+
+func (a *authenticator) authData(rpID string, attested bool) []byte {
+	hash := sha256.Sum256([]byte(rpID))
+	a.signCount++
+	data := append(hash[:], a.flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[33:], a.signCount)
+	if attested {
+		data[32] |= FlagAttested
+		data = append(data, make([]byte, 16)...)
+		data = append(data, byte(len(a.id)>>8), byte(len(a.id)))
+		data = append(append(data, a.id...), a.coseKey()...)
+	}
+	return data
+}
+
+func (a *authenticator) sign(data []byte) []byte {
+	if a.edKey != nil {
+		return ed25519.Sign(a.edKey, data)
+	}
+	digest := sha256.Sum256(data)
+	sig, _ := ecdsa.SignASN1(rand.Reader, a.ecKey, digest[:])
+	return sig
+}
+
+func clientDataJSON(ceremony, challenge, origin string) []byte {
+	data, _ := json.Marshal(clientData{Type: ceremony, Challenge: challenge, Origin: origin})
+	return data
+}
+
+// create acts as navigator.credentials.create().
+func (a *authenticator) create(rpID, challenge, origin string, selfAttest bool) ([]byte, []byte) {
+	clientData := clientDataJSON("webauthn.create", challenge, origin)
+	authData := a.authData(rpID, true)
+	statement := map[interface{}]interface{}{}
+	format := "none"
+	if selfAttest {
+		format = "packed"
+		alg := AlgES256
+		if a.edKey != nil {
+			alg = AlgEdDSA
+		}
+		statement["alg"] = alg
+		statement["sig"] = a.sign(signedData(authData, clientData))
+	}
+	return clientData, encodeCBOR(map[interface{}]interface{}{"fmt": format, "attStmt": statement, "authData": authData})
+}
+
+// get acts as navigator.credentials.get().
+func (a *authenticator) get(rpID, challenge, origin string) ([]byte, []byte, []byte) {
+	clientData := clientDataJSON("webauthn.get", challenge, origin)
+	authData := a.authData(rpID, false)
+	return clientData, authData, a.sign(signedData(authData, clientData))
+}
+
+var rp = &RelyingParty{ID: "example.com", Name: "Pandora", Origins: []string{"https://example.com"}}
+
+func register(t *testing.T, a *authenticator, selfAttest bool) *Credential {
+	challenge := NewChallenge([]byte("registration challenge"))
+	clientData, attestation := a.create("example.com", challenge, "https://example.com", selfAttest)
+	credential, err := rp.VerifyRegistration(challenge, clientData, attestation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return credential
+}
+
+func TestCeremonies(t *testing.T) {
+	for _, eddsa := range []bool{false, true} {
+		a := newAuthenticator(t, eddsa)
+		credential := register(t, a, eddsa)
+		assert.Equal(t, a.id, credential.ID)
+		assert.Equal(t, uint32(1), credential.SignCount)
+		assert.True(t, credential.UserVerified)
+
+		challenge := NewChallenge([]byte("login challenge"))
+		clientData, authData, sig := a.get("example.com", challenge, "https://example.com")
+		assertion, err := rp.VerifyAssertion(challenge, credential.PublicKey, credential.SignCount, clientData, authData, sig)
+		if assert.Nil(t, err) {
+			assert.Equal(t, uint32(2), assertion.SignCount)
+			assert.True(t, assertion.UserVerified)
+		}
+
+		// a replayed assertion doesn't increase sign count.
+		_, err = rp.VerifyAssertion(challenge, credential.PublicKey, assertion.SignCount, clientData, authData, sig)
+		assert.Equal(t, ErrSignCount, err)
+	}
+}
+
+func TestRegistration_Rejected(t *testing.T) {
+	a := newAuthenticator(t, false)
+	challenge := NewChallenge([]byte("registration challenge"))
+
+	clientData, attestation := a.create("example.com", challenge, "https://evil.com", false)
+	_, err := rp.VerifyRegistration(challenge, clientData, attestation)
+	assert.Equal(t, ErrOriginMismatch, err)
+
+	clientData, attestation = a.create("evil.com", challenge, "https://example.com", false)
+	_, err = rp.VerifyRegistration(challenge, clientData, attestation)
+	assert.Equal(t, ErrRPIDMismatch, err)
+
+	clientData, attestation = a.create("example.com", challenge, "https://example.com", false)
+	_, err = rp.VerifyRegistration(NewChallenge([]byte("another challenge")), clientData, attestation)
+	assert.Equal(t, ErrChallengeMismatch, err)
+
+	_, err = rp.VerifyRegistration(challenge, clientData, attestation[:len(attestation)-1])
+	assert.Equal(t, ErrInvalidAttestation, err)
+
+	a.flags = FlagUserPresent
+	strict := *rp
+	strict.RequireUserVerification = true
+	clientData, attestation = a.create("example.com", challenge, "https://example.com", false)
+	_, err = strict.VerifyRegistration(challenge, clientData, attestation)
+	assert.Equal(t, ErrUserNotVerified, err)
+}
+
+func TestAssertion_Rejected(t *testing.T) {
+	a := newAuthenticator(t, false)
+	credential := register(t, a, false)
+	challenge := NewChallenge([]byte("login challenge"))
+
+	clientData, authData, sig := a.get("example.com", challenge, "https://example.com")
+	sig[len(sig)-1] ^= 1
+	_, err := rp.VerifyAssertion(challenge, credential.PublicKey, credential.SignCount, clientData, authData, sig)
+	assert.Equal(t, ErrInvalidSig, err)
+
+	// signature of another authenticator
+	other := newAuthenticator(t, false)
+	other.signCount = a.signCount
+	clientData, authData, sig = other.get("example.com", challenge, "https://example.com")
+	_, err = rp.VerifyAssertion(challenge, credential.PublicKey, credential.SignCount, clientData, authData, sig)
+	assert.Equal(t, ErrInvalidSig, err)
+
+	// a registration response can't be used to log in.
+	clientData = clientDataJSON("webauthn.create", challenge, "https://example.com")
+	_, err = rp.VerifyAssertion(challenge, credential.PublicKey, credential.SignCount, clientData, authData, sig)
+	assert.Equal(t, ErrInvalidClientData, err)
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	item, rest, err := decodeCBOR(encodeCBOR(map[interface{}]interface{}{"a": -500, 1: []byte{1, 2}}))
+	assert.Nil(t, err)
+	assert.Empty(t, rest)
+	assert.Equal(t, map[interface{}]interface{}{"a": int64(-500), int64(1): []byte{1, 2}}, item)
+
+	nested := make([]byte, 0)
+	for i := 0; i <= maxCBORDepth+1; i++ {
+		nested = append(nested, 0x81) // array of one item
+	}
+	_, _, err = decodeCBOR(append(nested, 0x00))
+	assert.Equal(t, ErrInvalidCBOR, err)
+
+	// lengths beyond data must not be trusted.
+	_, _, err = decodeCBOR([]byte{0x9a, 0xff, 0xff, 0xff, 0xff})
+	assert.Equal(t, ErrInvalidCBOR, err)
+	_, _, err = decodeCBOR([]byte{0x5a, 0x00, 0x00, 0x00, 0x10, 0x01})
+	assert.Equal(t, ErrInvalidCBOR, err)
+}